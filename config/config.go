@@ -1,15 +1,28 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"github.com/ilyakaznacheev/cleanenv"
 	"sync"
+	"time"
 	"user/internal/logging"
 )
 
 type Config struct {
-	BrokerCfg BrokerCfg `yaml:"broker"`
-	DbCfg     DbCfg     `yaml:"db"`
-	RedisCfg  RedisCfg  `yaml:"redis"`
+	BrokerCfg     BrokerCfg     `yaml:"broker"`
+	DbCfg         DbCfg         `yaml:"db"`
+	RedisCfg      RedisCfg      `yaml:"redis"`
+	TokenCfg      TokenCfg      `yaml:"token"`
+	AdminCfg      AdminCfg      `yaml:"admin"`
+	ValidationCfg ValidationCfg `yaml:"validation"`
+	PasswordCfg   PasswordCfg   `yaml:"password"`
+	LockoutCfg    LockoutCfg    `yaml:"lockout"`
+	RateLimitCfg  RateLimitCfg  `yaml:"rate_limit"`
+	MFACfg        MFACfg        `yaml:"mfa"`
+	ResetCfg      ResetCfg      `yaml:"password_reset"`
+	EmailCfg      EmailCfg      `yaml:"email"`
+	AccountCfg    AccountCfg    `yaml:"account"`
 }
 
 type BrokerCfg struct {
@@ -32,6 +45,193 @@ type RedisCfg struct {
 	Port string `yaml:"port"`
 }
 
+// TokenCfg holds the signing secrets. Every secret can be given inline, through
+// the environment or as a path to a file (e.g. a mounted docker/k8s secret);
+// the file wins when both are set. With RS256, ES256 or EdDSA access tokens are
+// signed with the PEM private key instead of the access secret, or with the
+// active key of the keyring when keyring_dir is set.
+type TokenCfg struct {
+	SigningAlgorithm  string        `yaml:"signing_algorithm" env:"SIGNING_ALGORITHM" env-default:"HS256"`
+	PrivateKeyFile    string        `yaml:"private_key_file" env:"PRIVATE_KEY_FILE"`
+	KeyID             string        `yaml:"key_id" env:"KEY_ID"`
+	KeyringDir        string        `yaml:"keyring_dir" env:"KEYRING_DIR"`
+	RetiredKeyTTL     time.Duration `yaml:"retired_key_ttl" env:"RETIRED_KEY_TTL" env-default:"15m"`
+	AccessSecret      string        `yaml:"access_secret" env:"ACCESS_SECRET"`
+	AccessSecretFile  string        `yaml:"access_secret_file" env:"ACCESS_SECRET_FILE"`
+	RefreshSecret     string        `yaml:"refresh_secret" env:"REFRESH_SECRET"`
+	RefreshSecretFile string        `yaml:"refresh_secret_file" env:"REFRESH_SECRET_FILE"`
+	MinSecretLength   int           `yaml:"min_secret_length" env:"MIN_SECRET_LENGTH" env-default:"32"`
+	Scope             string        `yaml:"scope" env:"TOKEN_SCOPE" env-default:"user"`
+	Issuer            string        `yaml:"issuer" env:"TOKEN_ISSUER" env-default:"user-service"`
+	Audience          string        `yaml:"audience" env:"TOKEN_AUDIENCE" env-default:"api"`
+	AccessTTL         time.Duration `yaml:"access_ttl" env:"ACCESS_TTL" env-default:"15m"`
+	RefreshTTL        time.Duration `yaml:"refresh_ttl" env:"REFRESH_TTL" env-default:"168h"`
+	MaxSessionAge     time.Duration `yaml:"max_session_age" env:"MAX_SESSION_AGE" env-default:"720h"`
+	// IdleTimeout turns on sliding sessions, see the service lifetime policy
+	IdleTimeout time.Duration `yaml:"idle_timeout" env:"IDLE_TIMEOUT"`
+	// Clients are keyed by the client_id sent with a sign-in
+	Clients map[string]ClientCfg `yaml:"clients"`
+}
+
+// ClientCfg overrides the token settings for one client, zero values fall
+// back to the defaults of TokenCfg.
+type ClientCfg struct {
+	Audience      string        `yaml:"audience"`
+	AccessTTL     time.Duration `yaml:"access_ttl"`
+	RefreshTTL    time.Duration `yaml:"refresh_ttl"`
+	MaxSessionAge time.Duration `yaml:"max_session_age"`
+	IdleTimeout   time.Duration `yaml:"idle_timeout"`
+}
+
+func (c TokenCfg) Validate() error {
+
+	if c.AccessTTL <= 0 || c.RefreshTTL <= 0 || c.MaxSessionAge <= 0 {
+		return errors.New("token lifetimes must be positive")
+	}
+
+	check := func(name string, client ClientCfg) error {
+		accessTTL, maxSessionAge := c.AccessTTL, c.MaxSessionAge
+		if client.AccessTTL > 0 {
+			accessTTL = client.AccessTTL
+		}
+		if client.MaxSessionAge > 0 {
+			maxSessionAge = client.MaxSessionAge
+		}
+		if accessTTL > maxSessionAge {
+			return fmt.Errorf("%s: access_ttl exceeds max_session_age", name)
+		}
+		// a retired key must outlive every access token it has signed
+		if accessTTL > c.RetiredKeyTTL {
+			return fmt.Errorf("%s: access_ttl exceeds retired_key_ttl", name)
+		}
+		return nil
+	}
+
+	err := check("token", ClientCfg{})
+	if err != nil {
+		return err
+	}
+
+	for clientID, client := range c.Clients {
+		err = check("client "+clientID, client)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AdminCfg guards the admin subjects: a request must carry the token in the
+// Admin-Token header. Admin subjects are refused while no token is set.
+type AdminCfg struct {
+	Token string `yaml:"token" env:"ADMIN_TOKEN"`
+}
+
+// ValidationCfg limits what sign-up, sign-in and profile updates accept.
+// Lengths are counted in characters, except password_max_length which is in
+// bytes as it bounds the work of the password hasher.
+type ValidationCfg struct {
+	MaxPayloadSize    int    `yaml:"max_payload_size" env:"MAX_PAYLOAD_SIZE" env-default:"4096"`
+	UsernameMinLength int    `yaml:"username_min_length" env:"USERNAME_MIN_LENGTH" env-default:"3"`
+	UsernameMaxLength int    `yaml:"username_max_length" env:"USERNAME_MAX_LENGTH" env-default:"32"`
+	UsernamePattern   string `yaml:"username_pattern" env:"USERNAME_PATTERN" env-default:"^[a-zA-Z0-9._-]+$"`
+	PasswordMaxLength int    `yaml:"password_max_length" env:"PASSWORD_MAX_LENGTH" env-default:"256"`
+
+	DisplayNameMaxLength int `yaml:"display_name_max_length" env:"DISPLAY_NAME_MAX_LENGTH" env-default:"64"`
+	EmailMaxLength       int `yaml:"email_max_length" env:"EMAIL_MAX_LENGTH" env-default:"254"`
+}
+
+// PasswordCfg is the policy for new passwords and how they are hashed.
+// MinClasses counts the kinds of characters used out of lowercase, uppercase,
+// digits and symbols. Hashes of another algorithm or with other parameters are
+// replaced on the next sign-in.
+type PasswordCfg struct {
+	MinLength         int    `yaml:"min_length" env:"PASSWORD_MIN_LENGTH" env-default:"8"`
+	MinClasses        int    `yaml:"min_classes" env:"PASSWORD_MIN_CLASSES" env-default:"2"`
+	BreachedListFile  string `yaml:"breached_list_file" env:"PASSWORD_BREACHED_LIST_FILE"`
+	HashAlgorithm     string `yaml:"hash_algorithm" env:"PASSWORD_HASH_ALGORITHM" env-default:"argon2id"`
+	BcryptCost        int    `yaml:"bcrypt_cost" env:"BCRYPT_COST" env-default:"10"`
+	Argon2Memory      uint32 `yaml:"argon2_memory" env:"ARGON2_MEMORY" env-default:"19456"`
+	Argon2Iterations  uint32 `yaml:"argon2_iterations" env:"ARGON2_ITERATIONS" env-default:"2"`
+	Argon2Parallelism uint8  `yaml:"argon2_parallelism" env:"ARGON2_PARALLELISM" env-default:"1"`
+	ScryptLogN        int    `yaml:"scrypt_log_n" env:"SCRYPT_LOG_N" env-default:"16"`
+	ScryptR           int    `yaml:"scrypt_r" env:"SCRYPT_R" env-default:"8"`
+	ScryptP           int    `yaml:"scrypt_p" env:"SCRYPT_P" env-default:"1"`
+}
+
+// LockoutCfg throttles password guessing. Failed sign-ins are counted per
+// username and per client IP. From backoff_after failures on every attempt has
+// to wait backoff_base, doubled with each further failure up to backoff_max.
+// At max_failures (source_max_failures for an IP) the username or IP is locked
+// for lockout_duration; zero disables the lock. Counters are forgotten after
+// failure_window without a failure.
+type LockoutCfg struct {
+	MaxFailures       int           `yaml:"max_failures" env:"LOCKOUT_MAX_FAILURES" env-default:"5"`
+	SourceMaxFailures int           `yaml:"source_max_failures" env:"LOCKOUT_SOURCE_MAX_FAILURES" env-default:"20"`
+	BackoffAfter      int           `yaml:"backoff_after" env:"LOCKOUT_BACKOFF_AFTER" env-default:"2"`
+	BackoffBase       time.Duration `yaml:"backoff_base" env:"LOCKOUT_BACKOFF_BASE" env-default:"1s"`
+	BackoffMax        time.Duration `yaml:"backoff_max" env:"LOCKOUT_BACKOFF_MAX" env-default:"1m"`
+	LockoutDuration   time.Duration `yaml:"lockout_duration" env:"LOCKOUT_DURATION" env-default:"15m"`
+	FailureWindow     time.Duration `yaml:"failure_window" env:"LOCKOUT_FAILURE_WINDOW" env-default:"15m"`
+}
+
+// RateLimitCfg limits the requests per subject and caller in a sliding window.
+// The caller is the value of identity_header, else the identity_field of a
+// JSON payload; callers with neither share one window per subject. The header
+// must be set by a trusted gateway, callers could pick any value otherwise.
+type RateLimitCfg struct {
+	IdentityHeader string           `yaml:"identity_header" env:"RATE_LIMIT_IDENTITY_HEADER" env-default:"Client-Ip"`
+	IdentityField  string           `yaml:"identity_field" env:"RATE_LIMIT_IDENTITY_FIELD" env-default:"client_ip"`
+	Default        Limit            `yaml:"default"`
+	Subjects       map[string]Limit `yaml:"subjects"`
+}
+
+// Limit allows Requests per Window, zero means no limit.
+type Limit struct {
+	Requests int           `yaml:"requests"`
+	Window   time.Duration `yaml:"window"`
+}
+
+// MFACfg configures TOTP. The encryption key protects the secrets in the
+// database: 32 random bytes, base64 encoded, inline or in a file. MFA is off
+// while no key is set. Skew is the number of 30 second steps a code may be
+// early or late.
+type MFACfg struct {
+	Issuer            string        `yaml:"issuer" env:"MFA_ISSUER" env-default:"user-service"`
+	EncryptionKey     string        `yaml:"encryption_key" env:"MFA_ENCRYPTION_KEY"`
+	EncryptionKeyFile string        `yaml:"encryption_key_file" env:"MFA_ENCRYPTION_KEY_FILE"`
+	Skew              int           `yaml:"skew" env:"MFA_SKEW" env-default:"1"`
+	ChallengeTTL      time.Duration `yaml:"challenge_ttl" env:"MFA_CHALLENGE_TTL" env-default:"5m"`
+	MaxAttempts       int           `yaml:"max_attempts" env:"MFA_MAX_ATTEMPTS" env-default:"5"`
+	RecoveryCodes     int           `yaml:"recovery_codes" env:"MFA_RECOVERY_CODES" env-default:"10"`
+}
+
+// ResetCfg configures password reset. The token is appended to LinkURL as the
+// token query parameter, the mailer sends the resulting link.
+type ResetCfg struct {
+	TokenTTL time.Duration `yaml:"token_ttl" env:"PASSWORD_RESET_TOKEN_TTL" env-default:"30m"`
+	LinkURL  string        `yaml:"link_url" env:"PASSWORD_RESET_LINK_URL"`
+}
+
+// EmailCfg configures the verification of email addresses. With
+// RequireVerified a user without a verified address can't sign in, that
+// includes users with no address at all.
+type EmailCfg struct {
+	RequireVerified bool          `yaml:"require_verified" env:"EMAIL_REQUIRE_VERIFIED" env-default:"false"`
+	TokenTTL        time.Duration `yaml:"token_ttl" env:"EMAIL_TOKEN_TTL" env-default:"24h"`
+	LinkURL         string        `yaml:"link_url" env:"EMAIL_LINK_URL"`
+}
+
+// AccountCfg configures account deletion. A deleted account can be restored
+// for GracePeriod, then the purge job, running every PurgeInterval, deletes
+// the row or with Anonymize strips it of everything personal.
+type AccountCfg struct {
+	GracePeriod   time.Duration `yaml:"grace_period" env:"ACCOUNT_GRACE_PERIOD" env-default:"720h"`
+	PurgeInterval time.Duration `yaml:"purge_interval" env:"ACCOUNT_PURGE_INTERVAL" env-default:"1h"`
+	Anonymize     bool          `yaml:"anonymize" env:"ACCOUNT_ANONYMIZE" env-default:"false"`
+}
+
 var (
 	instance *Config
 	once     sync.Once
@@ -3,23 +3,25 @@ package db
 import (
 	"context"
 	"fmt"
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"user/config"
 	"user/internal/logging"
 )
 
-func InitDb(cfg config.DbCfg) (*pgx.Conn, error) {
+// InitDb opens a connection pool, a single pgx connection must not be shared by
+// the concurrent NATS handlers and background jobs.
+func InitDb(cfg config.DbCfg) (*pgxpool.Pool, error) {
 
 	log := logging.GetLogger()
 
 	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DbName, cfg.Sslmode)
 
-	dbConn, err := pgx.Connect(context.Background(), dsn)
+	dbPool, err := pgxpool.New(context.Background(), dsn)
 	if err != nil {
 		log.Fatalf("cannot to connect to database: %v", err)
 		return nil, err
 	}
 
-	return dbConn, nil
+	return dbPool, nil
 }
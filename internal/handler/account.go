@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/nats-io/nats.go"
+	"user/internal/logging"
+	"user/internal/model"
+	"user/internal/service"
+)
+
+func (h *Handler) DeleteAccount(msg *nats.Msg) {
+
+	var request model.AccountDeletion
+
+	h.log(msg).WithField("payload", logging.RedactJSON(msg.Data)).Debug("request")
+
+	err := h.Validator.Payload(msg.Data)
+	if err != nil {
+		h.replyValidationError(msg, err)
+		return
+	}
+
+	err = json.Unmarshal(msg.Data, &request)
+	if err != nil {
+		h.replyBadRequest(msg, err)
+		return
+	}
+
+	accessDetails, err := h.Service.VerifyAccessToken(request.AccessToken)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	err = h.Validator.AccountDeletion(&request)
+	if err != nil {
+		h.replyValidationError(msg, err)
+		return
+	}
+
+	err = h.Service.DeleteAccount(accessDetails.UserId, request.Password)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	h.reply(msg, model.Message{Message: "account deleted"})
+}
+
+// RestoreAccount takes the credentials of the deleted account, so it goes
+// through the same lockout as a sign-in.
+func (h *Handler) RestoreAccount(msg *nats.Msg) {
+
+	var (
+		request model.AccountRestore
+		client  model.ClientInfo
+	)
+
+	h.log(msg).WithField("payload", logging.RedactJSON(msg.Data)).Debug("request")
+
+	err := h.Validator.Payload(msg.Data)
+	if err != nil {
+		h.replyValidationError(msg, err)
+		return
+	}
+
+	err = json.Unmarshal(msg.Data, &request)
+	if err != nil {
+		h.replyBadRequest(msg, err)
+		return
+	}
+
+	err = json.Unmarshal(msg.Data, &client)
+	if err != nil {
+		h.replyBadRequest(msg, err)
+		return
+	}
+
+	err = h.Validator.AccountRestore(&request)
+	if err != nil {
+		h.replyValidationError(msg, err)
+		return
+	}
+
+	err = h.Service.CheckLogin(request.Name, client.ClientIP)
+	if err != nil {
+		h.log(msg).WithField("name", request.Name).Warn(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	err = h.Service.RestoreAccount(request.Name, request.Password)
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		h.log(msg).WithField("name", request.Name).Warn("failed restore")
+		lockErr := h.Service.RecordLoginFailure(request.Name, client.ClientIP)
+		if lockErr != nil {
+			h.log(msg).Error(lockErr)
+		}
+		h.replyServiceError(msg, err)
+		return
+	}
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	h.reply(msg, model.Message{Message: "account restored, sign in again"})
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/nats-io/nats.go"
+	"user/internal/logging"
+	"user/internal/model"
+	"user/internal/validation"
+	"user/pkg/response"
+)
+
+const adminTokenHeader = "Admin-Token"
+
+func (h *Handler) authorizeAdmin(msg *nats.Msg) bool {
+
+	if h.Config.AdminCfg.Token == "" {
+		h.log(msg).Warn("admin subject called but no admin token is configured")
+		return false
+	}
+
+	token := msg.Header.Get(adminTokenHeader)
+
+	if subtle.ConstantTimeCompare([]byte(token), []byte(h.Config.AdminCfg.Token)) != 1 {
+		h.log(msg).Warn("admin subject called with an invalid admin token")
+		return false
+	}
+
+	return true
+}
+
+func (h *Handler) RotateKeys(msg *nats.Msg) {
+
+	if !h.authorizeAdmin(msg) {
+		h.replyError(msg, response.CodeForbidden, "forbidden", nil)
+		return
+	}
+
+	jwks, err := h.Service.RotateKeys()
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	jwksBytes, err := json.Marshal(jwks)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	// let the other instances reload the keyring and the consumers refresh their cache
+	h.Nats.Publish("user.jwks.updated", jwksBytes)
+
+	h.reply(msg, jwks)
+}
+
+func (h *Handler) ReloadKeys(msg *nats.Msg) {
+
+	err := h.Service.ReloadKeys()
+	if err != nil {
+		h.log(msg).Error(err)
+		return
+	}
+
+	h.log(msg).Info("signing keys reloaded")
+}
+
+func (h *Handler) ClearLockout(msg *nats.Msg) {
+
+	if !h.authorizeAdmin(msg) {
+		h.replyError(msg, response.CodeForbidden, "forbidden", nil)
+		return
+	}
+
+	var request *model.ClearLockout
+
+	err := json.Unmarshal(msg.Data, &request)
+	if err != nil {
+		h.replyBadRequest(msg, err)
+		return
+	}
+
+	if request == nil || request.Name == "" && request.Source == "" {
+		h.replyError(msg, response.CodeValidationFailed, "validation failed", validation.Errors{
+			{Field: "name", Message: "name or source is required"},
+		})
+		return
+	}
+
+	err = h.Service.ClearLockout(request.Name, request.Source)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	h.log(msg).WithFields(logging.Fields{"name": request.Name, "source": request.Source}).Info("lockout cleared")
+
+	h.reply(msg, model.Message{Message: "Lockout cleared"})
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/nats-io/nats.go"
+	"user/internal/logging"
+	"user/internal/model"
+)
+
+// RequestEmailVerification answers before it looks the user up, like
+// RequestPasswordReset.
+func (h *Handler) RequestEmailVerification(msg *nats.Msg) {
+
+	var request model.EmailVerificationRequest
+
+	h.log(msg).WithField("payload", logging.RedactJSON(msg.Data)).Debug("request")
+
+	err := h.Validator.Payload(msg.Data)
+	if err != nil {
+		h.replyValidationError(msg, err)
+		return
+	}
+
+	err = json.Unmarshal(msg.Data, &request)
+	if err != nil {
+		h.replyBadRequest(msg, err)
+		return
+	}
+
+	err = h.Validator.EmailVerificationRequest(&request)
+	if err != nil {
+		h.replyValidationError(msg, err)
+		return
+	}
+
+	h.reply(msg, model.Message{Message: "if the account has an unverified address, a verification link is on its way"})
+
+	err = h.Service.RequestEmailVerification(request.Name)
+	if err != nil {
+		h.log(msg).Error(err)
+	}
+}
+
+func (h *Handler) ConfirmEmailVerification(msg *nats.Msg) {
+
+	var request model.EmailVerificationConfirm
+
+	h.log(msg).WithField("payload", logging.RedactJSON(msg.Data)).Debug("request")
+
+	err := h.Validator.Payload(msg.Data)
+	if err != nil {
+		h.replyValidationError(msg, err)
+		return
+	}
+
+	err = json.Unmarshal(msg.Data, &request)
+	if err != nil {
+		h.replyBadRequest(msg, err)
+		return
+	}
+
+	err = h.Validator.EmailVerificationConfirm(&request)
+	if err != nil {
+		h.replyValidationError(msg, err)
+		return
+	}
+
+	err = h.Service.ConfirmEmailVerification(request.Token)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	h.reply(msg, model.Message{Message: "email address verified"})
+}
@@ -2,353 +2,531 @@ package handler
 
 import (
 	"encoding/json"
-	"fmt"
-	"github.com/dgrijalva/jwt-go"
+	"errors"
 	"github.com/nats-io/nats.go"
 	"os"
 	"os/signal"
-	"strconv"
 	"syscall"
+	"time"
+	"user/config"
 	"user/internal/logging"
 	"user/internal/model"
+	"user/internal/ratelimit"
 	"user/internal/service"
+	"user/internal/validation"
 )
 
 type Handler struct {
-	Nats    *nats.Conn
-	Logger  *logging.Logger
-	Service *service.Service
+	Nats      *nats.Conn
+	Logger    *logging.Logger
+	Service   *service.Service
+	Config    *config.Config
+	Validator *validation.Validator
+	Limiter   *ratelimit.Limiter
 }
 
-func NewHandler(nats *nats.Conn, log *logging.Logger, service *service.Service) *Handler {
+func NewHandler(nats *nats.Conn, log *logging.Logger, service *service.Service, cfg *config.Config, validator *validation.Validator, limiter *ratelimit.Limiter) *Handler {
 	return &Handler{
-		Nats:    nats,
-		Logger:  log,
-		Service: service,
+		Nats:      nats,
+		Logger:    log,
+		Service:   service,
+		Config:    cfg,
+		Validator: validator,
+		Limiter:   limiter,
 	}
 }
 
 func (h *Handler) Init() {
-	sub, err := h.Nats.Subscribe("user.sign-up", h.SignUp)
+	sub, err := h.Nats.Subscribe("user.sign-up", h.limited(h.SignUp))
 	if err != nil {
 		h.Logger.Error(err)
 		return
 	}
 
-	sub, err = h.Nats.Subscribe("user.sign-in", h.SignIn)
+	sub, err = h.Nats.Subscribe("user.sign-in", h.limited(h.SignIn))
 	if err != nil {
 		h.Logger.Error(err)
 		return
 	}
 
-	sub, err = h.Nats.Subscribe("user.refresh", h.Refresh)
+	sub, err = h.Nats.Subscribe("user.sign-in.mfa", h.limited(h.SignInMFA))
 	if err != nil {
 		h.Logger.Error(err)
 		return
 	}
 
-	sub, err = h.Nats.Subscribe("user.sign-out", h.SignOut)
+	sub, err = h.Nats.Subscribe("user.refresh", h.limited(h.Refresh))
 	if err != nil {
 		h.Logger.Error(err)
 		return
 	}
 
-	sub, err = h.Nats.Subscribe("user.token-valid", h.TokenValid)
+	sub, err = h.Nats.Subscribe("user.sign-out", h.limited(h.SignOut))
 	if err != nil {
 		h.Logger.Error(err)
 		return
 	}
 
-	defer sub.Unsubscribe()
+	sub, err = h.Nats.Subscribe("user.sign-out-all", h.limited(h.SignOutAll))
+	if err != nil {
+		h.Logger.Error(err)
+		return
+	}
 
-	done := make(chan os.Signal, 1)
-	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-	<-done
-}
+	sub, err = h.Nats.Subscribe("user.token-valid", h.limited(h.TokenValid))
+	if err != nil {
+		h.Logger.Error(err)
+		return
+	}
 
-func (h *Handler) SignUp(msg *nats.Msg) {
+	sub, err = h.Nats.Subscribe("user.token.introspect", h.limited(h.Introspect))
+	if err != nil {
+		h.Logger.Error(err)
+		return
+	}
 
-	var u *model.User
+	sub, err = h.Nats.Subscribe("user.sessions.list", h.limited(h.ListSessions))
+	if err != nil {
+		h.Logger.Error(err)
+		return
+	}
+
+	sub, err = h.Nats.Subscribe("user.sessions.revoke", h.limited(h.RevokeSession))
+	if err != nil {
+		h.Logger.Error(err)
+		return
+	}
 
-	fmt.Println(string(msg.Data))
+	sub, err = h.Nats.Subscribe("user.password.change", h.limited(h.ChangePassword))
+	if err != nil {
+		h.Logger.Error(err)
+		return
+	}
 
-	err := json.Unmarshal(msg.Data, &u)
+	sub, err = h.Nats.Subscribe("user.password.reset.request", h.limited(h.RequestPasswordReset))
 	if err != nil {
-		h.Logger.Errorf("cannot unmarshal message: %s", err.Error())
-		h.Nats.Publish(msg.Reply, []byte(fmt.Sprintf("cannot unmarshal message: %s", err.Error())))
+		h.Logger.Error(err)
 		return
 	}
 
-	existsUser, err := h.Service.ExistsUser(u.Name)
+	sub, err = h.Nats.Subscribe("user.password.reset.confirm", h.limited(h.ConfirmPasswordReset))
 	if err != nil {
 		h.Logger.Error(err)
-		h.Nats.Publish(msg.Reply, []byte("internal server error"))
 		return
 	}
-	if existsUser {
-		h.Logger.Println("such user exists")
-		h.Nats.Publish(msg.Reply, []byte("such user exists"))
+
+	sub, err = h.Nats.Subscribe("user.email.verify.request", h.limited(h.RequestEmailVerification))
+	if err != nil {
+		h.Logger.Error(err)
 		return
 	}
 
-	userID, err := h.Service.CreateUser(u)
+	sub, err = h.Nats.Subscribe("user.email.verify.confirm", h.limited(h.ConfirmEmailVerification))
 	if err != nil {
-		h.Logger.Println(err)
-		h.Nats.Publish(msg.Reply, []byte("internal server error"))
+		h.Logger.Error(err)
 		return
 	}
 
-	userId := strconv.Itoa(userID)
+	sub, err = h.Nats.Subscribe("user.account.delete", h.limited(h.DeleteAccount))
+	if err != nil {
+		h.Logger.Error(err)
+		return
+	}
 
-	h.Nats.Publish(msg.Reply, []byte(userId))
-}
+	sub, err = h.Nats.Subscribe("user.account.restore", h.limited(h.RestoreAccount))
+	if err != nil {
+		h.Logger.Error(err)
+		return
+	}
 
-func (h *Handler) SignIn(msg *nats.Msg) {
+	sub, err = h.Nats.Subscribe("user.profile.get", h.limited(h.GetProfile))
+	if err != nil {
+		h.Logger.Error(err)
+		return
+	}
 
-	var u *model.User
+	sub, err = h.Nats.Subscribe("user.profile.update", h.limited(h.UpdateProfile))
+	if err != nil {
+		h.Logger.Error(err)
+		return
+	}
 
-	fmt.Println(string(msg.Data))
+	sub, err = h.Nats.Subscribe("user.mfa.enroll", h.limited(h.EnrollMFA))
+	if err != nil {
+		h.Logger.Error(err)
+		return
+	}
 
-	err := json.Unmarshal(msg.Data, &u)
+	sub, err = h.Nats.Subscribe("user.mfa.confirm", h.limited(h.ConfirmMFA))
 	if err != nil {
-		h.Logger.Errorf("cannot unmarshal message: %s", err.Error())
-		h.Nats.Publish(msg.Reply, []byte(fmt.Sprintf("cannot unmarshal message: %s", err.Error())))
+		h.Logger.Error(err)
 		return
 	}
 
-	userID, err := h.Service.GetUser(u)
+	sub, err = h.Nats.Subscribe("user.mfa.disable", h.limited(h.DisableMFA))
 	if err != nil {
 		h.Logger.Error(err)
-		h.Nats.Publish(msg.Reply, []byte("internal server error"))
 		return
 	}
 
-	td, err := h.Service.CreateToken(userID)
+	sub, err = h.Nats.Subscribe("user.mfa.status", h.limited(h.MFAStatus))
 	if err != nil {
 		h.Logger.Error(err)
-		h.Nats.Publish(msg.Reply, []byte("internal server error"))
 		return
 	}
 
-	err = h.Service.CreateAuth(userID, td)
+	sub, err = h.Nats.Subscribe("user.mfa.recovery-codes.regenerate", h.limited(h.RegenerateRecoveryCodes))
 	if err != nil {
 		h.Logger.Error(err)
-		h.Nats.Publish(msg.Reply, []byte("internal server error"))
 		return
 	}
 
-	tokens := map[string]string{
-		"access_token":  td.AccessToken,
-		"refresh_token": td.RefreshToken,
+	sub, err = h.Nats.Subscribe("user.jwks", h.limited(h.JWKS))
+	if err != nil {
+		h.Logger.Error(err)
+		return
 	}
 
-	tokensBytes, err := json.Marshal(tokens)
+	sub, err = h.Nats.Subscribe("user.jwks.updated", h.ReloadKeys)
 	if err != nil {
 		h.Logger.Error(err)
-		h.Nats.Publish(msg.Reply, []byte("internal server error"))
 		return
 	}
 
-	h.Nats.Publish(msg.Reply, tokensBytes)
+	sub, err = h.Nats.Subscribe("user.admin.keys.rotate", h.limited(h.RotateKeys))
+	if err != nil {
+		h.Logger.Error(err)
+		return
+	}
+
+	sub, err = h.Nats.Subscribe("user.admin.lockout.clear", h.limited(h.ClearLockout))
+	if err != nil {
+		h.Logger.Error(err)
+		return
+	}
+
+	defer sub.Unsubscribe()
+
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	<-done
+}
+
+// log tags every line with the subject. Secrets are masked by the logger, still
+// log payloads only through logging.RedactJSON.
+func (h *Handler) log(msg *nats.Msg) *logging.Logger {
+	return h.Logger.With(logging.Fields{"subject": msg.Subject})
 }
 
-func (h *Handler) Refresh(msg *nats.Msg) {
+func (h *Handler) SignUp(msg *nats.Msg) {
+
+	var u *model.User
 
-	mapToken := map[string]string{}
+	h.log(msg).WithField("payload", logging.RedactJSON(msg.Data)).Debug("request")
 
-	err := json.Unmarshal(msg.Data, &mapToken)
+	err := h.Validator.Payload(msg.Data)
 	if err != nil {
-		h.Logger.Errorf("cannot unmarshal message: %s", err.Error())
-		h.Nats.Publish(msg.Reply, []byte(fmt.Sprintf("cannot unmarshal message: %s", err.Error())))
+		h.replyValidationError(msg, err)
 		return
 	}
 
-	refreshToken := mapToken["refresh_token"]
+	err = json.Unmarshal(msg.Data, &u)
+	if err != nil {
+		h.replyBadRequest(msg, err)
+		return
+	}
 
-	// verify the token
-	err = os.Setenv("REFRESH_SECRET", "secret")
+	// nothing reaches the database before the payload is valid
+	err = h.Validator.SignUp(u)
 	if err != nil {
-		h.Logger.Error(err)
+		h.replyValidationError(msg, err)
 		return
 	}
 
-	token, err := jwt.Parse(refreshToken, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	userID, err := h.Service.CreateUser(u)
+	if errors.Is(err, service.ErrUserExists) {
+		h.log(msg).WithField("name", u.Name).Info("such user exists")
+		h.replyServiceError(msg, err)
+		return
+	}
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	h.reply(msg, model.UserID{UserID: userID})
+
+	if u.Email != "" {
+		err = h.Service.SendEmailVerification(userID)
+		if err != nil {
+			h.log(msg).Error(err)
 		}
-		return []byte(os.Getenv("REFRESH_SECRET")), nil
-	})
-	//if there is an error, the token must have expired
+	}
+}
+
+func (h *Handler) SignIn(msg *nats.Msg) {
+
+	var (
+		u      *model.User
+		client *model.ClientInfo
+	)
+
+	h.log(msg).WithField("payload", logging.RedactJSON(msg.Data)).Debug("request")
+
+	err := h.Validator.Payload(msg.Data)
 	if err != nil {
-		h.Logger.Error(err)
-		h.Nats.Publish(msg.Reply, []byte("expired refresh token"))
+		h.replyValidationError(msg, err)
 		return
 	}
 
-	// is token valid?
-	if _, ok := token.Claims.(jwt.Claims); !ok && !token.Valid {
-		h.Logger.Error("invalid token")
-		h.Nats.Publish(msg.Reply, []byte("invalid token"))
+	err = json.Unmarshal(msg.Data, &u)
+	if err != nil {
+		h.replyBadRequest(msg, err)
 		return
 	}
 
-	// since token is valid, get the uuid:
-	claims, ok := token.Claims.(jwt.MapClaims) //the token claims should conform to MapClaims
-	if ok && token.Valid {
-		refreshUuid, ok := claims["refresh_uuid"].(string) //convert the interface to string
-		if !ok {
-			h.Logger.Error(err)
-			h.Nats.Publish(msg.Reply, []byte("internal server error"))
-			return
-		}
-		//userId, err := strconv.ParseUint(fmt.Sprintf("%.f", claims["user_id"]), 10, 64)
-		//if err != nil {
-		//	c.JSON(http.StatusUnprocessableEntity, "Error occurred")
-		//	return
-		//}
-
-		userID := claims["user_id"].(int)
-
-		// delete the previous Refresh Token
-		deleted, delErr := h.Service.DeleteAuth(refreshUuid)
-		if delErr != nil || deleted == 0 {
-			h.Logger.Error(err)
-			h.Nats.Publish(msg.Reply, []byte("internal server error"))
-			return
-		}
+	// the device fields travel next to the credentials
+	err = json.Unmarshal(msg.Data, &client)
+	if err != nil {
+		h.replyBadRequest(msg, err)
+		return
+	}
 
-		// create new pairs of refresh and access tokens
-		ts, createErr := h.Service.CreateToken(userID)
-		if createErr != nil {
-			h.Logger.Error(err)
-			h.Nats.Publish(msg.Reply, []byte("internal server error"))
-			return
-		}
-		tokens := map[string]string{
-			"access_token":  ts.AccessToken,
-			"refresh_token": ts.RefreshToken,
+	err = h.Validator.SignIn(u)
+	if err != nil {
+		h.replyValidationError(msg, err)
+		return
+	}
+
+	// a locked account is refused before the password is even looked at
+	err = h.Service.CheckLogin(u.Name, client.ClientIP)
+	if err != nil {
+		h.log(msg).WithField("name", u.Name).Warn(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	userID, err := h.Service.GetUser(u)
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		h.log(msg).WithField("name", u.Name).Warn("failed sign in")
+		lockErr := h.Service.RecordLoginFailure(u.Name, client.ClientIP)
+		if lockErr != nil {
+			h.log(msg).Error(lockErr)
 		}
+		h.replyServiceError(msg, err)
+		return
+	}
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	mfaEnabled, err := h.Service.MFAEnabled(userID)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
 
-		tokensBytes, err := json.Marshal(tokens)
-		if delErr != nil {
-			h.Logger.Error(err)
-			h.Nats.Publish(msg.Reply, []byte("internal server error"))
+	// the password alone is not enough, the tokens come from user.sign-in.mfa.
+	// The failures are only forgotten once the code is right as well.
+	if mfaEnabled {
+		challenge, err := h.Service.CreateMFAChallenge(userID, u.Name, client)
+		if err != nil {
+			h.log(msg).Error(err)
+			h.replyServiceError(msg, err)
 			return
 		}
 
-		h.Nats.Publish(msg.Reply, tokensBytes)
+		h.reply(msg, challenge)
+		return
+	}
 
-	} else {
-		h.Nats.Publish(msg.Reply, []byte("expired token"))
+	err = h.Service.RecordLoginSuccess(u.Name)
+	if err != nil {
+		h.log(msg).Error(err)
 	}
 
+	h.issueTokens(msg, userID, client)
 }
 
-func (h *Handler) SignOut(msg *nats.Msg) {
+// issueTokens starts a new session and replies with its token pair
+func (h *Handler) issueTokens(msg *nats.Msg, userID int, client *model.ClientInfo) {
 
-	// extract token
-	bearToken := string(msg.Data)
+	td, err := h.Service.CreateToken(userID, &model.TokenFamily{ClientID: client.ClientID})
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
 
-	err := os.Setenv("ACCESS_SECRET", "secret")
+	err = h.Service.CreateAuth(userID, td)
 	if err != nil {
-		h.Logger.Error(err)
-		h.Nats.Publish(msg.Reply, []byte("internal server error"))
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
 		return
 	}
 
-	// verify token
-	jwtToken, err := jwt.Parse(bearToken, func(token *jwt.Token) (interface{}, error) {
-		// Make sure that the token method confirm to "SigningMethodHMAC"
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			h.Logger.Errorf("unexpected signing method: %v", token.Header["alg"])
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
+	err = h.Service.CreateSession(userID, td, client)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
 
-		return []byte(os.Getenv("ACCESS_SECRET")), nil
+	h.reply(msg, model.TokenPair{
+		AccessToken:  td.AccessToken,
+		RefreshToken: td.RefreshToken,
 	})
+}
+
+func (h *Handler) Refresh(msg *nats.Msg) {
+
+	var pair model.TokenPair
+
+	err := json.Unmarshal(msg.Data, &pair)
 	if err != nil {
-		h.Logger.Error(err)
-		h.Nats.Publish(msg.Reply, []byte(err.Error()))
+		h.replyBadRequest(msg, err)
+		return
+	}
+
+	// verify and rotate the token
+	ts, err := h.Service.RefreshToken(pair.RefreshToken)
+
+	var reuseErr *service.TokenReuseError
+	if errors.As(err, &reuseErr) {
+		h.log(msg).WithFields(logging.Fields{
+			"family_id": reuseErr.FamilyID,
+			"user_id":   reuseErr.UserID,
+		}).Warn("refresh token reuse detected, family revoked")
+		h.publishTokenReuse(msg, reuseErr)
+	}
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
 		return
 	}
 
-	// extract token metadata
+	h.reply(msg, model.TokenPair{
+		AccessToken:  ts.AccessToken,
+		RefreshToken: ts.RefreshToken,
+	})
+}
 
-	var accessDetails *model.AccessDetails
+// security tooling listens on user.security.* to react to stolen tokens
+func (h *Handler) publishTokenReuse(msg *nats.Msg, reuseErr *service.TokenReuseError) {
 
-	claims, ok := jwtToken.Claims.(jwt.MapClaims)
-	if ok && jwtToken.Valid {
-		accessUuid, ok := claims["access_uuid"].(string)
-		if !ok {
-			h.Logger.Error(err)
-			h.Nats.Publish(msg.Reply, []byte("internal server error"))
-			return
-		}
+	event := model.TokenReuseEvent{
+		UserID:      reuseErr.UserID,
+		FamilyID:    reuseErr.FamilyID,
+		RefreshUuid: reuseErr.RefreshUuid,
+		DetectedAt:  time.Now().UTC(),
+	}
 
-		userID, ok := claims["user_id"].(int)
-		if !ok {
-			h.Logger.Error(err)
-			h.Nats.Publish(msg.Reply, []byte("internal server error"))
-			return
-		}
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		h.log(msg).Error(err)
+		return
+	}
 
-		accessDetails.AccessUuid = accessUuid
-		accessDetails.UserId = userID
+	err = h.Nats.Publish("user.security.refresh-token-reused", eventBytes)
+	if err != nil {
+		h.log(msg).Error(err)
 	}
+}
+
+func (h *Handler) SignOut(msg *nats.Msg) {
 
-	deleted, err := h.Service.DeleteAuth(accessDetails.AccessUuid)
+	// extract token
+	bearToken := string(msg.Data)
+
+	// verify token and extract token metadata
+	accessDetails, err := h.Service.VerifyAccessToken(bearToken)
 	if err != nil {
-		h.Logger.Error(err)
-		h.Nats.Publish(msg.Reply, []byte("internal server error"))
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
 		return
 	}
-	if err != nil || deleted == 0 {
-		h.Logger.Error(err)
-		h.Nats.Publish(msg.Reply, []byte("internal server error"))
+
+	// signing out ends the session, the refresh token goes with the access token
+	err = h.Service.RevokeSession(accessDetails.UserId, accessDetails.SessionID)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
 		return
 	}
 
-	h.Nats.Publish(msg.Reply, []byte("Successfully logged out"))
+	h.reply(msg, model.Message{Message: "Successfully logged out"})
 }
 
-func (h *Handler) TokenValid(msg *nats.Msg) {
+func (h *Handler) SignOutAll(msg *nats.Msg) {
 
 	// extract token
 	bearToken := string(msg.Data)
 
-	err := os.Setenv("ACCESS_SECRET", "secret")
+	accessDetails, err := h.Service.VerifyAccessToken(bearToken)
 	if err != nil {
-		h.Logger.Error(err)
-		h.Nats.Publish(msg.Reply, []byte("internal server error"))
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	err = h.Service.SignOut(accessDetails.UserId)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
 		return
 	}
 
+	h.reply(msg, model.Message{Message: "Successfully logged out everywhere"})
+}
+
+func (h *Handler) TokenValid(msg *nats.Msg) {
+
+	// extract token
+	bearToken := string(msg.Data)
+
 	// verify token
-	jwtToken, err := jwt.Parse(bearToken, func(token *jwt.Token) (interface{}, error) {
-		// Make sure that the token method confirm to "SigningMethodHMAC"
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			h.Logger.Errorf("unexpected signing method: %v", token.Header["alg"])
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
+	accessDetails, err := h.Service.VerifyAccessToken(bearToken)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
 
-		return []byte(os.Getenv("ACCESS_SECRET")), nil
-	})
+	h.reply(msg, model.UserID{UserID: accessDetails.UserId})
+}
+
+func (h *Handler) Introspect(msg *nats.Msg) {
+
+	var request model.IntrospectionRequest
+
+	err := json.Unmarshal(msg.Data, &request)
 	if err != nil {
-		h.Logger.Error(err)
-		h.Nats.Publish(msg.Reply, []byte(err.Error()))
+		h.replyBadRequest(msg, err)
 		return
 	}
 
-	// validation token
-	claims, ok := jwtToken.Claims.(jwt.MapClaims)
-	if !ok && !!jwtToken.Valid {
-		h.Logger.Println("token is not valid")
-		h.Nats.Publish(msg.Reply, []byte("token is not valid"))
+	introspection, err := h.Service.IntrospectToken(request.Token, request.TokenTypeHint)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
 		return
 	}
 
-	userId := claims["user_id"].(int)
-	userID := strconv.Itoa(userId)
+	h.reply(msg, introspection)
+}
+
+func (h *Handler) JWKS(msg *nats.Msg) {
+
+	jwks, err := h.Service.JWKS()
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
 
-	h.Nats.Publish(msg.Reply, []byte(userID))
+	h.reply(msg, jwks)
 }
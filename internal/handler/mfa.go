@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/nats-io/nats.go"
+	"user/internal/model"
+)
+
+func (h *Handler) EnrollMFA(msg *nats.Msg) {
+
+	// extract token
+	bearToken := string(msg.Data)
+
+	accessDetails, err := h.Service.VerifyAccessToken(bearToken)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	enrollment, err := h.Service.EnrollMFA(accessDetails.UserId)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	h.reply(msg, enrollment)
+}
+
+func (h *Handler) ConfirmMFA(msg *nats.Msg) {
+
+	var request model.MFACode
+
+	err := json.Unmarshal(msg.Data, &request)
+	if err != nil {
+		h.replyBadRequest(msg, err)
+		return
+	}
+
+	accessDetails, err := h.Service.VerifyAccessToken(request.AccessToken)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	codes, err := h.Service.ConfirmMFA(accessDetails.UserId, request.Code)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	h.reply(msg, codes)
+}
+
+func (h *Handler) DisableMFA(msg *nats.Msg) {
+
+	var request model.MFACode
+
+	err := json.Unmarshal(msg.Data, &request)
+	if err != nil {
+		h.replyBadRequest(msg, err)
+		return
+	}
+
+	accessDetails, err := h.Service.VerifyAccessToken(request.AccessToken)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	err = h.Service.DisableMFA(accessDetails.UserId, request.Code)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	h.reply(msg, model.Message{Message: "mfa disabled"})
+}
+
+func (h *Handler) MFAStatus(msg *nats.Msg) {
+
+	// extract token
+	bearToken := string(msg.Data)
+
+	accessDetails, err := h.Service.VerifyAccessToken(bearToken)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	status, err := h.Service.MFAStatus(accessDetails.UserId)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	h.reply(msg, status)
+}
+
+func (h *Handler) RegenerateRecoveryCodes(msg *nats.Msg) {
+
+	var request model.MFACode
+
+	err := json.Unmarshal(msg.Data, &request)
+	if err != nil {
+		h.replyBadRequest(msg, err)
+		return
+	}
+
+	accessDetails, err := h.Service.VerifyAccessToken(request.AccessToken)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	codes, err := h.Service.RegenerateRecoveryCodes(accessDetails.UserId, request.Code)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	h.reply(msg, codes)
+}
+
+// SignInMFA is the second step of a sign-in with MFA: the challenge of
+// user.sign-in and a code give the token pair.
+func (h *Handler) SignInMFA(msg *nats.Msg) {
+
+	var request model.MFASignIn
+
+	err := json.Unmarshal(msg.Data, &request)
+	if err != nil {
+		h.replyBadRequest(msg, err)
+		return
+	}
+
+	userID, client, err := h.Service.VerifyMFAChallenge(request.ChallengeToken, request.Code, request.RecoveryCode)
+	if err != nil {
+		h.log(msg).Warn(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	h.issueTokens(msg, userID, client)
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/nats-io/nats.go"
+	"user/internal/logging"
+	"user/internal/model"
+)
+
+func (h *Handler) ChangePassword(msg *nats.Msg) {
+
+	var request model.PasswordChange
+
+	h.log(msg).WithField("payload", logging.RedactJSON(msg.Data)).Debug("request")
+
+	err := h.Validator.Payload(msg.Data)
+	if err != nil {
+		h.replyValidationError(msg, err)
+		return
+	}
+
+	err = json.Unmarshal(msg.Data, &request)
+	if err != nil {
+		h.replyBadRequest(msg, err)
+		return
+	}
+
+	accessDetails, err := h.Service.VerifyAccessToken(request.AccessToken)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	err = h.Validator.PasswordChange(&request)
+	if err != nil {
+		h.replyValidationError(msg, err)
+		return
+	}
+
+	err = h.Service.ChangePassword(accessDetails.UserId, accessDetails.SessionID, &request)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	h.reply(msg, model.Message{Message: "password changed"})
+}
+
+// RequestPasswordReset answers before it looks the user up, so the reply and
+// its timing are the same whether or not the account exists.
+func (h *Handler) RequestPasswordReset(msg *nats.Msg) {
+
+	var request model.PasswordResetRequest
+
+	h.log(msg).WithField("payload", logging.RedactJSON(msg.Data)).Debug("request")
+
+	err := h.Validator.Payload(msg.Data)
+	if err != nil {
+		h.replyValidationError(msg, err)
+		return
+	}
+
+	err = json.Unmarshal(msg.Data, &request)
+	if err != nil {
+		h.replyBadRequest(msg, err)
+		return
+	}
+
+	err = h.Validator.PasswordResetRequest(&request)
+	if err != nil {
+		h.replyValidationError(msg, err)
+		return
+	}
+
+	h.reply(msg, model.Message{Message: "if the account exists, a reset link is on its way"})
+
+	err = h.Service.RequestPasswordReset(request.Name)
+	if err != nil {
+		h.log(msg).Error(err)
+	}
+}
+
+func (h *Handler) ConfirmPasswordReset(msg *nats.Msg) {
+
+	var request model.PasswordResetConfirm
+
+	h.log(msg).WithField("payload", logging.RedactJSON(msg.Data)).Debug("request")
+
+	err := h.Validator.Payload(msg.Data)
+	if err != nil {
+		h.replyValidationError(msg, err)
+		return
+	}
+
+	err = json.Unmarshal(msg.Data, &request)
+	if err != nil {
+		h.replyBadRequest(msg, err)
+		return
+	}
+
+	err = h.Validator.PasswordResetConfirm(&request)
+	if err != nil {
+		h.replyValidationError(msg, err)
+		return
+	}
+
+	err = h.Service.ConfirmPasswordReset(request.Token, request.Password)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	h.reply(msg, model.Message{Message: "password reset, sign in with the new password"})
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/nats-io/nats.go"
+	"user/internal/logging"
+	"user/internal/model"
+)
+
+func (h *Handler) GetProfile(msg *nats.Msg) {
+
+	// extract token
+	bearToken := string(msg.Data)
+
+	accessDetails, err := h.Service.VerifyAccessToken(bearToken)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	profile, err := h.Service.GetProfile(accessDetails.UserId)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	profile.MFA, err = h.Service.MFAStatus(accessDetails.UserId)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	h.reply(msg, profile)
+}
+
+func (h *Handler) UpdateProfile(msg *nats.Msg) {
+
+	var request model.ProfileUpdate
+
+	h.log(msg).WithField("payload", logging.RedactJSON(msg.Data)).Debug("request")
+
+	err := h.Validator.Payload(msg.Data)
+	if err != nil {
+		h.replyValidationError(msg, err)
+		return
+	}
+
+	err = json.Unmarshal(msg.Data, &request)
+	if err != nil {
+		h.replyBadRequest(msg, err)
+		return
+	}
+
+	accessDetails, err := h.Service.VerifyAccessToken(request.AccessToken)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	err = h.Validator.Profile(&request)
+	if err != nil {
+		h.replyValidationError(msg, err)
+		return
+	}
+
+	profile, err := h.Service.UpdateProfile(accessDetails.UserId, &request)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	h.reply(msg, profile)
+
+	// a new address has to be verified
+	if request.Email != nil && profile.Email != "" && profile.EmailVerifiedAt == nil {
+		err = h.Service.SendEmailVerification(accessDetails.UserId)
+		if err != nil {
+			h.log(msg).Error(err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/nats-io/nats.go"
+	"user/pkg/response"
+)
+
+const anonymousCaller = "anonymous"
+
+// limited applies the rate limit of the subject before the handler runs. When
+// Redis is down requests pass, an outage of the limiter must not take the
+// service down with it.
+func (h *Handler) limited(next nats.MsgHandler) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+
+		retryAfter, err := h.Limiter.Allow(msg.Subject, h.callerIdentity(msg))
+		if err != nil {
+			h.log(msg).Error(err)
+		}
+
+		if retryAfter > 0 {
+			h.log(msg).Warn("rate limited")
+			h.replyRetryLater(msg, response.CodeRateLimited, "too many requests, try again later", retryAfter)
+			return
+		}
+
+		next(msg)
+	}
+}
+
+func (h *Handler) callerIdentity(msg *nats.Msg) string {
+
+	cfg := h.Config.RateLimitCfg
+
+	if cfg.IdentityHeader != "" && msg.Header != nil {
+		if identity := msg.Header.Get(cfg.IdentityHeader); identity != "" {
+			return identity
+		}
+	}
+
+	// bare tokens are no JSON, don't bother decoding them
+	if cfg.IdentityField != "" && bytes.HasPrefix(bytes.TrimSpace(msg.Data), []byte("{")) {
+		var fields map[string]json.RawMessage
+		var identity string
+
+		if json.Unmarshal(msg.Data, &fields) == nil && json.Unmarshal(fields[cfg.IdentityField], &identity) == nil && identity != "" {
+			return identity
+		}
+	}
+
+	return anonymousCaller
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"errors"
+	"github.com/nats-io/nats.go"
+	"strconv"
+	"time"
+	"user/internal/keys"
+	"user/internal/logging"
+	"user/internal/service"
+	"user/internal/validation"
+	"user/pkg/response"
+)
+
+func (h *Handler) reply(msg *nats.Msg, data interface{}) {
+
+	replyBytes, err := response.Success(data)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyError(msg, response.CodeInternal, "internal server error", nil)
+		return
+	}
+
+	err = h.Nats.Publish(msg.Reply, replyBytes)
+	if err != nil {
+		h.log(msg).Error(err)
+	}
+}
+
+func (h *Handler) replyError(msg *nats.Msg, code, message string, details interface{}) {
+
+	err := h.Nats.PublishMsg(h.errorReply(msg, code, message, details))
+	if err != nil {
+		h.log(msg).Error(err)
+	}
+}
+
+// replyRetryLater is an error reply that tells the caller when to try again,
+// in the details and in the Retry-After header.
+func (h *Handler) replyRetryLater(msg *nats.Msg, code, message string, retryAfter time.Duration) {
+
+	// round up, retrying a moment too early fails again
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+
+	reply := h.errorReply(msg, code, message, response.RetryDetails{RetryAfter: seconds})
+	reply.Header.Set(response.HeaderRetryAfter, strconv.Itoa(seconds))
+
+	err := h.Nats.PublishMsg(reply)
+	if err != nil {
+		h.log(msg).Error(err)
+	}
+}
+
+func (h *Handler) errorReply(msg *nats.Msg, code, message string, details interface{}) *nats.Msg {
+
+	replyBytes, err := response.Failure(code, message, details)
+	if err != nil {
+		h.log(msg).Error(err)
+		replyBytes = []byte(`{"ok":false,"error":{"code":"INTERNAL","message":"internal server error"}}`)
+	}
+
+	reply := nats.NewMsg(msg.Reply)
+	reply.Data = replyBytes
+	reply.Header.Set(response.HeaderErrorCode, code)
+	reply.Header.Set(response.HeaderErrorMessage, message)
+
+	return reply
+}
+
+// replyServiceError maps the errors of the service layer onto the error codes,
+// anything unknown is an internal error and its text never leaves the service.
+func (h *Handler) replyServiceError(msg *nats.Msg, err error) {
+
+	var (
+		reuseErr  *service.TokenReuseError
+		lockedErr *service.LockedError
+		fieldErrs validation.Errors
+	)
+
+	switch {
+	case errors.As(err, &lockedErr):
+		h.replyRetryLater(msg, response.CodeAccountLocked, "too many failed sign-ins, try again later", lockedErr.RetryAfter)
+	case errors.As(err, &fieldErrs):
+		h.replyError(msg, response.CodeValidationFailed, "validation failed", fieldErrs)
+	case errors.As(err, &reuseErr):
+		h.replyError(msg, response.CodeTokenReused, "refresh token reuse detected", nil)
+	case errors.Is(err, service.ErrTokenExpired):
+		h.replyError(msg, response.CodeTokenExpired, "token expired", nil)
+	case errors.Is(err, service.ErrTokenInvalid):
+		h.replyError(msg, response.CodeTokenInvalid, "invalid token", nil)
+	case errors.Is(err, service.ErrTokenRevoked):
+		h.replyError(msg, response.CodeTokenRevoked, "token revoked", nil)
+	case errors.Is(err, service.ErrUnknownClient):
+		h.replyError(msg, response.CodeUnknownClient, "unknown client", nil)
+	case errors.Is(err, service.ErrSessionNotFound):
+		h.replyError(msg, response.CodeSessionNotFound, "session not found", nil)
+	case errors.Is(err, service.ErrProfileConflict):
+		h.replyError(msg, response.CodeProfileConflict, "profile changed in the meantime, read it again", nil)
+	case errors.Is(err, service.ErrResetTokenInvalid):
+		h.replyError(msg, response.CodeResetTokenInvalid, "invalid or expired reset token, request a new one", nil)
+	case errors.Is(err, service.ErrVerificationTokenInvalid):
+		h.replyError(msg, response.CodeVerificationInvalid, "invalid or expired verification token, request a new one", nil)
+	case errors.Is(err, service.ErrEmailNotVerified):
+		h.replyError(msg, response.CodeEmailNotVerified, "email address not verified", nil)
+	case errors.Is(err, keys.ErrRotationUnsupported):
+		h.replyError(msg, response.CodeNotSupported, err.Error(), nil)
+	case errors.Is(err, service.ErrMFACodeInvalid):
+		h.replyError(msg, response.CodeMFACodeInvalid, "invalid mfa code", nil)
+	case errors.Is(err, service.ErrMFAChallengeInvalid):
+		h.replyError(msg, response.CodeMFAChallengeInvalid, "invalid or expired mfa challenge, sign in again", nil)
+	case errors.Is(err, service.ErrMFAAlreadyEnabled):
+		h.replyError(msg, response.CodeMFAAlreadyEnabled, "mfa already enabled", nil)
+	case errors.Is(err, service.ErrMFAEnrolmentConflict):
+		h.replyError(msg, response.CodeConflict, "mfa enrolment changed in the meantime, start again", nil)
+	case errors.Is(err, service.ErrMFANotEnabled):
+		h.replyError(msg, response.CodeMFANotEnabled, "mfa not enabled", nil)
+	case errors.Is(err, service.ErrMFAUnavailable):
+		h.replyError(msg, response.CodeNotSupported, "mfa is not available", nil)
+	case errors.Is(err, service.ErrEmailExists):
+		h.replyError(msg, response.CodeEmailExists, "email address in use", nil)
+	case errors.Is(err, service.ErrUserExists):
+		h.replyError(msg, response.CodeUserExists, "such user exists", nil)
+	case errors.Is(err, service.ErrInvalidCredentials):
+		h.replyError(msg, response.CodeInvalidCredentials, "wrong username or password", nil)
+	case errors.Is(err, service.ErrUnauthorized):
+		h.replyError(msg, response.CodeUnauthorized, "unauthorized", nil)
+	case errors.Is(err, service.ErrNotFound):
+		h.replyError(msg, response.CodeNotFound, "not found", nil)
+	case errors.Is(err, service.ErrConflict):
+		h.replyError(msg, response.CodeConflict, "conflict", nil)
+	default:
+		h.replyError(msg, response.CodeInternal, "internal server error", nil)
+	}
+}
+
+func (h *Handler) replyBadRequest(msg *nats.Msg, err error) {
+	h.log(msg).WithField("payload", logging.RedactJSON(msg.Data)).Errorf("cannot unmarshal message: %s", err.Error())
+	h.replyError(msg, response.CodeBadRequest, "cannot unmarshal message", err.Error())
+}
+
+// replyValidationError lists every rejected field in the details of the reply.
+func (h *Handler) replyValidationError(msg *nats.Msg, err error) {
+
+	var fieldErrs validation.Errors
+
+	switch {
+	case errors.As(err, &fieldErrs):
+		h.replyError(msg, response.CodeValidationFailed, "validation failed", fieldErrs)
+	case errors.Is(err, validation.ErrPayloadTooLarge):
+		h.replyError(msg, response.CodePayloadTooLarge, err.Error(), nil)
+	default:
+		h.replyBadRequest(msg, err)
+	}
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/nats-io/nats.go"
+	"user/internal/model"
+)
+
+func (h *Handler) ListSessions(msg *nats.Msg) {
+
+	// extract token
+	bearToken := string(msg.Data)
+
+	accessDetails, err := h.Service.VerifyAccessToken(bearToken)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	sessions, err := h.Service.ListSessions(accessDetails.UserId)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == accessDetails.SessionID
+	}
+
+	h.reply(msg, sessions)
+}
+
+func (h *Handler) RevokeSession(msg *nats.Msg) {
+
+	var revoke model.RevokeSession
+
+	err := json.Unmarshal(msg.Data, &revoke)
+	if err != nil {
+		h.replyBadRequest(msg, err)
+		return
+	}
+
+	accessDetails, err := h.Service.VerifyAccessToken(revoke.AccessToken)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	err = h.Service.RevokeSession(accessDetails.UserId, revoke.SessionID)
+	if err != nil {
+		h.log(msg).Error(err)
+		h.replyServiceError(msg, err)
+		return
+	}
+
+	h.reply(msg, model.Message{Message: "session revoked"})
+}
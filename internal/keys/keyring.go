@@ -0,0 +1,356 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"user/pkg/jwk"
+)
+
+const manifestFile = "keyring.json"
+
+var ErrRotationUnsupported = errors.New("key rotation requires an asymmetric signing algorithm and a keyring directory")
+
+type keyringEntry struct {
+	ID        string     `json:"kid"`
+	Algorithm string     `json:"alg"`
+	File      string     `json:"file"`
+	Created   time.Time  `json:"created"`
+	Retired   *time.Time `json:"retired,omitempty"`
+}
+
+type keyringManifest struct {
+	Active string         `json:"active"`
+	Keys   []keyringEntry `json:"keys"`
+}
+
+// Keyring holds the access token keys: the active one signs new tokens, the
+// retired ones only verify until every token they have signed is expired.
+// Keys are selected by the kid header.
+type Keyring struct {
+	mu        sync.RWMutex
+	dir       string
+	algorithm string
+	retention time.Duration
+	active    *SigningKey
+	keys      map[string]*SigningKey
+}
+
+func newStaticKeyring(key *SigningKey) *Keyring {
+	return &Keyring{
+		algorithm: key.Method.Alg(),
+		active:    key,
+		keys:      map[string]*SigningKey{key.ID: key},
+	}
+}
+
+func OpenKeyring(dir, algorithm, importFile string, retention time.Duration) (*Keyring, error) {
+
+	if dir == "" || algorithm == jwt.SigningMethodHS256.Alg() {
+		return nil, ErrRotationUnsupported
+	}
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create keyring directory: %w", err)
+	}
+
+	k := &Keyring{
+		dir:       dir,
+		algorithm: algorithm,
+		retention: retention,
+	}
+
+	_, err = os.Stat(filepath.Join(dir, manifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		// first start: import the configured key or generate a fresh one
+		err = k.bootstrap(importFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = k.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+func (k *Keyring) Active() *SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.active
+}
+
+func (k *Keyring) Lookup(kid string) (*SigningKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+func (k *Keyring) JWKS() (*jwk.JWKS, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	jwks := &jwk.JWKS{Keys: []jwk.JWK{}}
+
+	// shared secrets are never published
+	if k.active.Symmetric() {
+		return jwks, nil
+	}
+
+	for _, key := range k.keys {
+		published, err := newJWK(key)
+		if err != nil {
+			return nil, err
+		}
+		jwks.Keys = append(jwks.Keys, *published)
+	}
+
+	return jwks, nil
+}
+
+// Rotate generates a new active key, retires the current one and drops the
+// keys whose verification window is over.
+func (k *Keyring) Rotate() (*SigningKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.dir == "" {
+		return nil, ErrRotationUnsupported
+	}
+
+	manifest, err := k.readManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	key, entry, err := k.generate()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	var entries []keyringEntry
+	for _, e := range manifest.Keys {
+		if e.Retired == nil {
+			e.Retired = &now
+		}
+		if now.Sub(*e.Retired) > k.retention {
+			_ = os.Remove(filepath.Join(k.dir, e.File))
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	manifest.Active = entry.ID
+	manifest.Keys = append(entries, *entry)
+
+	err = k.writeManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	err = k.load(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Reload re-reads the keyring directory, e.g. after another instance or the
+// rotate-keys command has rotated it.
+func (k *Keyring) Reload() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.dir == "" {
+		return nil
+	}
+
+	manifest, err := k.readManifest()
+	if err != nil {
+		return err
+	}
+
+	return k.load(manifest)
+}
+
+func (k *Keyring) load(manifest *keyringManifest) error {
+
+	keys := map[string]*SigningKey{}
+	var active *SigningKey
+
+	for _, e := range manifest.Keys {
+		if e.Retired != nil && time.Since(*e.Retired) > k.retention {
+			continue
+		}
+
+		key, err := loadAsymmetricKey(e.Algorithm, filepath.Join(k.dir, e.File), e.ID)
+		if err != nil {
+			return fmt.Errorf("cannot load key %s: %w", e.ID, err)
+		}
+
+		keys[key.ID] = key
+		if key.ID == manifest.Active {
+			active = key
+		}
+	}
+
+	if active == nil {
+		return fmt.Errorf("keyring has no active key %q", manifest.Active)
+	}
+
+	k.active = active
+	k.keys = keys
+
+	return nil
+}
+
+func (k *Keyring) bootstrap(importFile string) error {
+
+	var (
+		entry *keyringEntry
+		err   error
+	)
+
+	if importFile != "" {
+		entry, err = k.importKey(importFile)
+	} else {
+		_, entry, err = k.generate()
+	}
+	if err != nil {
+		return err
+	}
+
+	return k.writeManifest(&keyringManifest{
+		Active: entry.ID,
+		Keys:   []keyringEntry{*entry},
+	})
+}
+
+func (k *Keyring) importKey(file string) (*keyringEntry, error) {
+
+	key, err := loadAsymmetricKey(k.algorithm, file, "")
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return k.store(key, data)
+}
+
+func (k *Keyring) generate() (*SigningKey, *keyringEntry, error) {
+
+	var (
+		privateKey crypto.Signer
+		err        error
+	)
+
+	switch k.algorithm {
+	case jwt.SigningMethodRS256.Alg():
+		privateKey, err = rsa.GenerateKey(rand.Reader, minRSABits)
+	case jwt.SigningMethodES256.Alg():
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case jwk.SigningMethodEd25519.Alg():
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, nil, fmt.Errorf("unsupported signing algorithm: %s", k.algorithm)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := newAsymmetricKey(k.algorithm, privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entry, err := k.store(key, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key, entry, nil
+}
+
+func (k *Keyring) store(key *SigningKey, pemBytes []byte) (*keyringEntry, error) {
+
+	file := key.ID + ".pem"
+
+	err := os.WriteFile(filepath.Join(k.dir, file), pemBytes, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("cannot write key file: %w", err)
+	}
+
+	return &keyringEntry{
+		ID:        key.ID,
+		Algorithm: key.Method.Alg(),
+		File:      file,
+		Created:   time.Now().UTC(),
+	}, nil
+}
+
+func (k *Keyring) readManifest() (*keyringManifest, error) {
+
+	data, err := os.ReadFile(filepath.Join(k.dir, manifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read keyring manifest: %w", err)
+	}
+
+	var manifest keyringManifest
+
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse keyring manifest: %w", err)
+	}
+
+	return &manifest, nil
+}
+
+func (k *Keyring) writeManifest(manifest *keyringManifest) error {
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write and rename so a concurrent Reload never sees a half written file
+	tmp := filepath.Join(k.dir, manifestFile+".tmp")
+
+	err = os.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return fmt.Errorf("cannot write keyring manifest: %w", err)
+	}
+
+	return os.Rename(tmp, filepath.Join(k.dir, manifestFile))
+}
@@ -0,0 +1,111 @@
+package keys
+
+import (
+	"github.com/dgrijalva/jwt-go"
+	"testing"
+	"time"
+)
+
+func TestKeyringJWKS(t *testing.T) {
+
+	tests := []struct {
+		alg string
+		kty string
+	}{
+		{"RS256", "RSA"},
+		{"ES256", "EC"},
+		{"EdDSA", "OKP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			keyring, err := OpenKeyring(t.TempDir(), tt.alg, "", time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			jwks, err := keyring.JWKS()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(jwks.Keys) != 1 {
+				t.Fatalf("JWKS() has %d keys, want 1", len(jwks.Keys))
+			}
+
+			published := jwks.Keys[0]
+			if published.Kty != tt.kty || published.Alg != tt.alg || published.Use != "sig" {
+				t.Errorf("JWKS() = %+v", published)
+			}
+
+			// the key ID is the RFC 7638 thumbprint
+			thumbprint, err := published.Thumbprint()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if published.Kid != thumbprint || keyring.Active().ID != thumbprint {
+				t.Errorf("kid %s, active %s, thumbprint %s", published.Kid, keyring.Active().ID, thumbprint)
+			}
+
+			// a token of the active key verifies with the published key
+			active := keyring.Active()
+			token, err := jwt.NewWithClaims(active.Method, jwt.StandardClaims{Subject: "1"}).SignedString(active.PrivateKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			publicKey, err := published.PublicKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = jwt.Parse(token, func(*jwt.Token) (interface{}, error) {
+				return publicKey, nil
+			})
+			if err != nil {
+				t.Errorf("token does not verify with the published key: %v", err)
+			}
+		})
+	}
+}
+
+func TestKeyringJWKSAfterRotation(t *testing.T) {
+
+	keyring, err := OpenKeyring(t.TempDir(), "ES256", "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	retired := keyring.Active().ID
+
+	active, err := keyring.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks, err := keyring.JWKS()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kids := map[string]bool{}
+	for _, published := range jwks.Keys {
+		kids[published.Kid] = true
+	}
+
+	// the retired key keeps verifying until its tokens have expired
+	if len(kids) != 2 || !kids[retired] || !kids[active.ID] {
+		t.Errorf("JWKS() has keys %v, want %s and %s", kids, retired, active.ID)
+	}
+}
+
+func TestKeyringJWKSWithSharedSecret(t *testing.T) {
+
+	keyring := newStaticKeyring(newHMACKey([]byte("a shared secret of enough length")))
+
+	jwks, err := keyring.JWKS()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(jwks.Keys) != 0 {
+		t.Errorf("JWKS() publishes %d shared secrets", len(jwks.Keys))
+	}
+}
@@ -0,0 +1,124 @@
+package keys
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"os"
+	"strings"
+	"user/config"
+)
+
+var weakSecrets = []string{
+	"secret",
+	"changeme",
+	"password",
+	"jwtsecret",
+	"access_secret",
+	"refresh_secret",
+}
+
+type Keys struct {
+	Access  *Keyring
+	Refresh []byte
+}
+
+func Load(cfg config.TokenCfg) (*Keys, error) {
+
+	refresh, err := readSecret("refresh", cfg.RefreshSecret, cfg.RefreshSecretFile)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateSecret("refresh", refresh, cfg.MinSecretLength)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := &Keys{
+		Refresh: refresh,
+	}
+
+	if cfg.SigningAlgorithm != jwt.SigningMethodHS256.Alg() && cfg.KeyringDir != "" {
+		keys.Access, err = OpenKeyring(cfg.KeyringDir, cfg.SigningAlgorithm, cfg.PrivateKeyFile, cfg.RetiredKeyTTL)
+		if err != nil {
+			return nil, err
+		}
+		return keys, nil
+	}
+
+	if cfg.SigningAlgorithm != jwt.SigningMethodHS256.Alg() {
+		key, err := loadAsymmetricKey(cfg.SigningAlgorithm, cfg.PrivateKeyFile, cfg.KeyID)
+		if err != nil {
+			return nil, err
+		}
+		keys.Access = newStaticKeyring(key)
+		return keys, nil
+	}
+
+	access, err := readSecret("access", cfg.AccessSecret, cfg.AccessSecretFile)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateSecret("access", access, cfg.MinSecretLength)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(access, refresh) {
+		return nil, errors.New("access and refresh secrets must differ")
+	}
+
+	keys.Access = newStaticKeyring(newHMACKey(access))
+
+	return keys, nil
+}
+
+func readSecret(name, value, file string) ([]byte, error) {
+
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s secret file: %w", name, err)
+		}
+		// files written by editors or `echo` usually end with a newline
+		return bytes.TrimRight(data, "\r\n"), nil
+	}
+
+	if value == "" {
+		return nil, fmt.Errorf("%s secret is not configured", name)
+	}
+
+	return []byte(value), nil
+}
+
+func validateSecret(name string, secret []byte, minLength int) error {
+
+	if len(secret) == 0 {
+		return fmt.Errorf("%s secret is empty", name)
+	}
+
+	if len(secret) < minLength {
+		return fmt.Errorf("%s secret is too short: %d bytes, at least %d required", name, len(secret), minLength)
+	}
+
+	lower := strings.ToLower(string(secret))
+	for _, weak := range weakSecrets {
+		// "secret", "secretsecret..." and the like
+		if strings.ReplaceAll(lower, weak, "") == "" {
+			return fmt.Errorf("%s secret is too weak", name)
+		}
+	}
+
+	distinct := map[byte]struct{}{}
+	for _, b := range secret {
+		distinct[b] = struct{}{}
+	}
+	if len(distinct) < 8 {
+		return fmt.Errorf("%s secret is too weak: not enough distinct characters", name)
+	}
+
+	return nil
+}
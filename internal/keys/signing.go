@@ -0,0 +1,142 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"os"
+	"user/pkg/jwk"
+)
+
+const minRSABits = 2048
+
+type SigningKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey interface{}
+	PublicKey  interface{}
+}
+
+func (k *SigningKey) Symmetric() bool {
+	_, ok := k.Method.(*jwt.SigningMethodHMAC)
+	return ok
+}
+
+func newHMACKey(secret []byte) *SigningKey {
+	return &SigningKey{
+		Method:     jwt.SigningMethodHS256,
+		PrivateKey: secret,
+		PublicKey:  secret,
+	}
+}
+
+func loadAsymmetricKey(algorithm, file, keyID string) (*SigningKey, error) {
+
+	if file == "" {
+		return nil, fmt.Errorf("%s requires a private key file", algorithm)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read private key file: %w", err)
+	}
+
+	privateKey, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := newAsymmetricKey(algorithm, privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if keyID != "" {
+		key.ID = keyID
+	}
+
+	return key, nil
+}
+
+func newAsymmetricKey(algorithm string, privateKey crypto.Signer) (*SigningKey, error) {
+
+	key := &SigningKey{
+		PrivateKey: privateKey,
+		PublicKey:  privateKey.Public(),
+	}
+
+	switch algorithm {
+	case jwt.SigningMethodRS256.Alg():
+		rsaKey, ok := privateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s requires an RSA private key", algorithm)
+		}
+		if rsaKey.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA key is too short: %d bits, at least %d required", rsaKey.N.BitLen(), minRSABits)
+		}
+		key.Method = jwt.SigningMethodRS256
+	case jwt.SigningMethodES256.Alg():
+		ecKey, ok := privateKey.(*ecdsa.PrivateKey)
+		if !ok || ecKey.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("%s requires a P-256 EC private key", algorithm)
+		}
+		key.Method = jwt.SigningMethodES256
+	case jwk.SigningMethodEd25519.Alg():
+		if _, ok := privateKey.(ed25519.PrivateKey); !ok {
+			return nil, fmt.Errorf("%s requires an Ed25519 private key", algorithm)
+		}
+		key.Method = jwk.SigningMethodEd25519
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+
+	published, err := newJWK(key)
+	if err != nil {
+		return nil, err
+	}
+
+	key.ID, err = published.Thumbprint()
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func newJWK(key *SigningKey) (*jwk.JWK, error) {
+	return jwk.New(key.ID, key.Method.Alg(), key.PublicKey)
+}
+
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("private key file is not PEM encoded")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+	}
+}
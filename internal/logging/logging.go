@@ -68,6 +68,9 @@ func init() {
 
 	l.SetOutput(io.Discard)
 
+	// hooks fire in order, nothing is written before it is redacted
+	l.AddHook(&redactHook{})
+
 	l.AddHook(&writeHook{
 		Writer:    []io.Writer{allFile, os.Stdout},
 		LogLevels: logrus.AllLevels,
@@ -77,3 +80,8 @@ func init() {
 
 	e = logrus.NewEntry(l)
 }
+
+// With returns a logger that adds the fields to every line.
+func (l *Logger) With(fields Fields) *Logger {
+	return &Logger{l.WithFields(fields)}
+}
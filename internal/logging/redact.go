@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"regexp"
+	"strings"
+)
+
+const Redacted = "[REDACTED]"
+
+type Fields = logrus.Fields
+
+// sensitiveKeys are masked wherever they show up as a log field or as a key of
+// a logged JSON payload, matched case-insensitively with "-" read as "_".
+var sensitiveKeys = map[string]bool{
+	"password":         true,
+	"old_password":     true,
+	"new_password":     true,
+	"current_password": true,
+	"token":            true,
+	"access_token":     true,
+	"refresh_token":    true,
+	"secret":           true,
+	"access_secret":    true,
+	"refresh_secret":   true,
+	"admin_token":      true,
+	"authorization":    true,
+	"code":             true,
+	"challenge_token":  true,
+	"recovery_code":    true,
+	"recovery_codes":   true,
+}
+
+// a JWT anywhere in a message: header and payload always start with {"
+var jwtPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]*`)
+
+func IsSensitive(key string) bool {
+	return sensitiveKeys[strings.ReplaceAll(strings.ToLower(key), "-", "_")]
+}
+
+// RedactJSON returns the payload for a log line with every sensitive key
+// masked. Anything that is not JSON is only described by its size, it may be
+// a bare token.
+func RedactJSON(data []byte) string {
+
+	var value interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	err := decoder.Decode(&value)
+	if err != nil {
+		return fmt.Sprintf("<%d bytes>", len(data))
+	}
+
+	redacted, err := json.Marshal(redactValue(value))
+	if err != nil {
+		return fmt.Sprintf("<%d bytes>", len(data))
+	}
+
+	return string(redacted)
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range v {
+			if IsSensitive(key) {
+				v[key] = Redacted
+				continue
+			}
+			v[key] = redactValue(nested)
+		}
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = redactValue(nested)
+		}
+	case string:
+		return jwtPattern.ReplaceAllString(v, Redacted)
+	}
+	return value
+}
+
+// redactHook runs before the write hook and masks sensitive fields and any
+// token that slipped into the message.
+type redactHook struct{}
+
+func (hook *redactHook) Fire(entry *logrus.Entry) error {
+
+	for key, value := range entry.Data {
+		if IsSensitive(key) {
+			entry.Data[key] = Redacted
+			continue
+		}
+		if s, ok := value.(string); ok {
+			entry.Data[key] = jwtPattern.ReplaceAllString(s, Redacted)
+		}
+	}
+
+	entry.Message = jwtPattern.ReplaceAllString(entry.Message, Redacted)
+
+	return nil
+}
+
+func (hook *redactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
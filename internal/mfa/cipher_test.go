@@ -0,0 +1,84 @@
+package mfa
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"user/config"
+)
+
+var testEncryptionKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+func TestLoadCipher(t *testing.T) {
+
+	keyFile := filepath.Join(t.TempDir(), "mfa.key")
+	err := os.WriteFile(keyFile, []byte(testEncryptionKey+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     config.MFACfg
+		wantErr bool
+	}{
+		{"key", config.MFACfg{EncryptionKey: testEncryptionKey}, false},
+		{"key file", config.MFACfg{EncryptionKeyFile: keyFile}, false},
+		{"no key", config.MFACfg{}, true},
+		{"not base64", config.MFACfg{EncryptionKey: "not base64!"}, true},
+		{"short key", config.MFACfg{EncryptionKey: base64.StdEncoding.EncodeToString([]byte("short"))}, true},
+		{"missing file", config.MFACfg{EncryptionKeyFile: filepath.Join(t.TempDir(), "missing")}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadCipher(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadCipher() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	_, err = LoadCipher(config.MFACfg{})
+	if !errors.Is(err, ErrNoEncryptionKey) {
+		t.Errorf("LoadCipher() without a key = %v, want ErrNoEncryptionKey", err)
+	}
+}
+
+func TestCipherBindsUser(t *testing.T) {
+
+	c, err := LoadCipher(config.MFACfg{EncryptionKey: testEncryptionKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ciphertext, err := c.Seal(rfc6238Secret, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := c.Open(ciphertext, 7)
+	if err != nil || string(plaintext) != string(rfc6238Secret) {
+		t.Errorf("Open() = %q, %v", plaintext, err)
+	}
+
+	// a secret copied to another user does not decrypt
+	_, err = c.Open(ciphertext, 8)
+	if err == nil {
+		t.Error("Open() for another user succeeded")
+	}
+
+	_, err = c.Open(append([]byte{2}, ciphertext[1:]...), 7)
+	if err == nil {
+		t.Error("Open() of an unknown version succeeded")
+	}
+
+	if c.MAC([]byte("code"), 7) != c.MAC([]byte("code"), 7) {
+		t.Error("MAC() is not deterministic")
+	}
+	if c.MAC([]byte("code"), 7) == c.MAC([]byte("code"), 8) {
+		t.Error("MAC() does not depend on the user")
+	}
+}
@@ -0,0 +1,50 @@
+package mfa
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+)
+
+// no 0/o, 1/i/l: codes are read from paper and typed by hand
+const recoveryAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+
+const recoveryCodeLength = 10
+
+// GenerateRecoveryCodes returns codes like "k3m9q-7xw2p", about 50 bits each.
+func GenerateRecoveryCodes(count int) ([]string, error) {
+
+	codes := make([]string, 0, count)
+	max := big.NewInt(int64(len(recoveryAlphabet)))
+
+	for i := 0; i < count; i++ {
+		var code strings.Builder
+
+		for j := 0; j < recoveryCodeLength; j++ {
+			if j == recoveryCodeLength/2 {
+				code.WriteByte('-')
+			}
+
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return nil, err
+			}
+			code.WriteByte(recoveryAlphabet[n.Int64()])
+		}
+
+		codes = append(codes, code.String())
+	}
+
+	return codes, nil
+}
+
+// NormalizeRecoveryCode accepts a code however it was typed: any case, with or
+// without the dash and spaces.
+func NormalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+}
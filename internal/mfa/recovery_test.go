@@ -0,0 +1,59 @@
+package mfa
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+
+	tests := []struct {
+		typed string
+		want  string
+	}{
+		{"k3m9q-7xw2p", "k3m9q7xw2p"},
+		{"K3M9Q-7XW2P", "k3m9q7xw2p"},
+		{"k3m9q7xw2p", "k3m9q7xw2p"},
+		{"  k3m9q-7xw2p\n", "k3m9q7xw2p"},
+		{"k3m9q 7xw2p", "k3m9q7xw2p"},
+		{"k3m 9q-7x w2p", "k3m9q7xw2p"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.typed, func(t *testing.T) {
+			if got := NormalizeRecoveryCode(tt.typed); got != tt.want {
+				t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", tt.typed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(codes) != 10 {
+		t.Fatalf("GenerateRecoveryCodes() returned %d codes", len(codes))
+	}
+
+	format := regexp.MustCompile(`^[23456789abcdefghjkmnpqrstuvwxyz]{5}-[23456789abcdefghjkmnpqrstuvwxyz]{5}$`)
+	seen := map[string]bool{}
+
+	for _, code := range codes {
+		if !format.MatchString(code) {
+			t.Errorf("code %q has the wrong format", code)
+		}
+		// a code is stored normalized, the printed form must survive it
+		if NormalizeRecoveryCode(code) != code[:5]+code[6:] {
+			t.Errorf("code %q does not normalize to itself", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q generated twice", code)
+		}
+		seen[code] = true
+	}
+}
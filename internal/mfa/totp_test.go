@@ -0,0 +1,104 @@
+package mfa
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// the SHA-1 seed of RFC 6238 appendix B
+var rfc6238Secret = []byte("12345678901234567890")
+
+func TestCode(t *testing.T) {
+
+	// appendix B lists 8 digits, 6 digit codes are their last six
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(time.Unix(tt.unix, 0).UTC().Format(time.RFC3339), func(t *testing.T) {
+			if got := Code(rfc6238Secret, Step(time.Unix(tt.unix, 0))); got != tt.want {
+				t.Errorf("Code() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	tests := []struct {
+		name     string
+		code     string
+		skew     int
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", Code(rfc6238Secret, current), 0, current, true},
+		{"previous step within skew", Code(rfc6238Secret, current-1), 1, current - 1, true},
+		{"next step within skew", Code(rfc6238Secret, current+1), 1, current + 1, true},
+		{"previous step without skew", Code(rfc6238Secret, current-1), 0, 0, false},
+		{"two steps back", Code(rfc6238Secret, current-2), 1, 0, false},
+		{"wrong code", "000000", 1, 0, false},
+		{"too short", Code(rfc6238Secret, current)[:5], 1, 0, false},
+		{"too long", Code(rfc6238Secret, current) + "0", 1, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Verify(rfc6238Secret, tt.code, now, tt.skew)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("Verify() = %d, %v, want %d, %v", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestURI(t *testing.T) {
+
+	uri, err := url.Parse(URI("User Service", "alice", rfc6238Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/User Service:alice" {
+		t.Errorf("URI() = %s", uri)
+	}
+
+	want := map[string]string{
+		"secret":    "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		"issuer":    "User Service",
+		"algorithm": "SHA1",
+		"digits":    "6",
+		"period":    "30",
+	}
+	for key, value := range want {
+		if got := uri.Query().Get(key); got != value {
+			t.Errorf("URI() %s = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 160 bits as RFC 4226 recommends, no padding in the encoded form
+	if len(secret) != 20 || len(EncodeSecret(secret)) != 32 {
+		t.Errorf("GenerateSecret() = %d bytes, encoded %s", len(secret), EncodeSecret(secret))
+	}
+}
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"user/pkg/claims"
+)
+
+func NewAccessDetails(c *claims.Access) (*AccessDetails, error) {
+
+	userID, err := claims.UserID(&c.StandardClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AccessDetails{
+		AccessUuid: c.Id,
+		SessionID:  c.SessionID,
+		UserId:     userID,
+		ClientID:   c.ClientID,
+		Scope:      c.Scope,
+		Issuer:     c.Issuer,
+		Audience:   c.Audience,
+		AuthTime:   c.AuthTime,
+		IssuedAt:   c.IssuedAt,
+		NotBefore:  c.NotBefore,
+		ExpiresAt:  c.ExpiresAt,
+	}, nil
+}
+
+func NewRefreshDetails(c *claims.Refresh) (*RefreshDetails, error) {
+
+	userID, err := claims.UserID(&c.StandardClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RefreshDetails{
+		RefreshUuid: c.Id,
+		FamilyID:    c.FamilyID,
+		UserId:      userID,
+		ClientID:    c.ClientID,
+		AuthTime:    c.AuthTime,
+		IssuedAt:    c.IssuedAt,
+		ExpiresAt:   c.ExpiresAt,
+	}, nil
+}
@@ -3,11 +3,21 @@ package model
 import "time"
 
 type User struct {
-	ID       int       `json:"-"`
-	Name     string    `json:"name"`
-	Password string    `json:"password"`
-	Created  time.Time `json:"-"`
-	Updated  time.Time `json:"-"`
+	ID              int        `json:"-"`
+	Name            string     `json:"name"`
+	Password        string     `json:"password"`
+	Email           string     `json:"email"`
+	EmailVerifiedAt *time.Time `json:"-"`
+	Created         time.Time  `json:"-"`
+	Updated         time.Time  `json:"-"`
+}
+
+// TokenFamily ties together the token pairs issued for one sign-in. An empty
+// ID and AuthTime mean a new sign-in.
+type TokenFamily struct {
+	ID       string
+	ClientID string
+	AuthTime int64
 }
 
 type TokenDetails struct {
@@ -15,16 +25,302 @@ type TokenDetails struct {
 	RefreshToken string `json:"refresh_token"`
 	AccessUuid   string `json:"access_uuid"`
 	RefreshUuid  string `json:"refresh_uuid"`
+	FamilyID     string `json:"family_id"`
+	AuthTime     int64  `json:"auth_time"`
 	AtExpires    int64  `json:"at_expires"`
 	RtExpires    int64  `json:"rt_expires"`
 }
 
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type UserID struct {
+	UserID int `json:"user_id"`
+}
+
+type Message struct {
+	Message string `json:"message"`
+}
+
 type AccessDetails struct {
 	AccessUuid string `json:"access_uuid"`
+	SessionID  string `json:"session_id"`
 	UserId     int    `json:"user_id"`
+	ClientID   string `json:"client_id"`
+	Scope      string `json:"scope"`
+	Issuer     string `json:"iss"`
+	Audience   string `json:"aud"`
+	AuthTime   int64  `json:"auth_time"`
+	IssuedAt   int64  `json:"iat"`
+	NotBefore  int64  `json:"nbf"`
+	ExpiresAt  int64  `json:"exp"`
+}
+
+type RefreshDetails struct {
+	RefreshUuid string `json:"refresh_uuid"`
+	FamilyID    string `json:"family_id"`
+	UserId      int    `json:"user_id"`
+	ClientID    string `json:"client_id"`
+	AuthTime    int64  `json:"auth_time"`
+	IssuedAt    int64  `json:"iat"`
+	ExpiresAt   int64  `json:"exp"`
+}
+
+type RevocationEvent struct {
+	UserID    int       `json:"user_id"`
+	Uuids     []string  `json:"uuids"`
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
+// LockoutEvent is published when an account or a client IP gets locked or
+// unlocked, only one of Name and Source is set. UserID is set when the name
+// belongs to a user.
+type LockoutEvent struct {
+	Name        string     `json:"name,omitempty"`
+	UserID      int        `json:"user_id,omitempty"`
+	Source      string     `json:"source,omitempty"`
+	Failures    int        `json:"failures,omitempty"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+	At          time.Time  `json:"at"`
+}
+
+type ClearLockout struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+// MFA is the TOTP enrolment of a user. The secret is encrypted and the
+// enrolment only counts once confirmed with a first code.
+type MFA struct {
+	UserID       int
+	Secret       []byte
+	Enabled      bool
+	LastUsedStep int64
+	Created      time.Time
+	Confirmed    *time.Time
+}
+
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type MFACode struct {
+	AccessToken string `json:"access_token"`
+	Code        string `json:"code"`
+}
+
+// MFAChallenge is the reply of user.sign-in for users with MFA, the challenge
+// token is exchanged on user.sign-in.mfa together with a code.
+type MFAChallenge struct {
+	MFARequired    bool   `json:"mfa_required"`
+	ChallengeToken string `json:"challenge_token"`
+	ExpiresIn      int    `json:"expires_in"`
+}
+
+// MFASignIn carries either a TOTP code or a recovery code
+type MFASignIn struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+// RecoveryCodes are shown once, only their hashes are stored
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type MFAStatus struct {
+	Enabled                bool `json:"enabled"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+type RecoveryCodeUsedEvent struct {
+	UserID    int       `json:"user_id"`
+	Remaining int       `json:"remaining"`
+	ClientIP  string    `json:"client_ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	UsedAt    time.Time `json:"used_at"`
+}
+
+type IntrospectionRequest struct {
+	Token         string `json:"token"`
+	TokenTypeHint string `json:"token_type_hint"`
+}
+
+// Introspection follows RFC 7662, an inactive token only carries active=false
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	UserID    int    `json:"user_id,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+	Aud       string `json:"aud,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Nbf       int64  `json:"nbf,omitempty"`
+	AuthTime  int64  `json:"auth_time,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+}
+
+type TokenReuseEvent struct {
+	UserID      int       `json:"user_id"`
+	FamilyID    string    `json:"family_id"`
+	RefreshUuid string    `json:"refresh_uuid"`
+	DetectedAt  time.Time `json:"detected_at"`
+}
+
+type ClientInfo struct {
+	ClientID   string `json:"client_id"`
+	ClientIP   string `json:"client_ip"`
+	UserAgent  string `json:"user_agent"`
+	DeviceName string `json:"device_name"`
+}
+
+// Session is a sign-in on one device. Its ID is the refresh token family, so
+// it survives token rotation and ends when the family is revoked.
+type Session struct {
+	ID         string    `json:"session_id"`
+	UserID     int       `json:"-"`
+	Created    time.Time `json:"created"`
+	LastUsed   time.Time `json:"last_used"`
+	ClientID   string    `json:"client_id"`
+	ClientIP   string    `json:"client_ip"`
+	UserAgent  string    `json:"user_agent"`
+	DeviceName string    `json:"device_name"`
+	Current    bool      `json:"current"`
+}
+
+type RevokeSession struct {
+	AccessToken string `json:"access_token"`
+	SessionID   string `json:"session_id"`
 }
 
 type Token struct {
 	ID    string `json:"-"`
 	Token string `json:"token"`
 }
+
+// Profile is what a user can read and edit about themselves. Updated is the
+// version of the profile, an update has to send back the one it read.
+type Profile struct {
+	UserID          int        `json:"user_id"`
+	Name            string     `json:"name"`
+	DisplayName     string     `json:"display_name"`
+	Email           string     `json:"email"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	Locale          string     `json:"locale"`
+	Timezone        string     `json:"timezone"`
+	Created         time.Time  `json:"created"`
+	Updated         time.Time  `json:"updated"`
+	// MFA is only filled in by user.profile.get
+	MFA *MFAStatus `json:"mfa,omitempty"`
+}
+
+// ProfileUpdate changes the fields that are set, an empty string clears one.
+type ProfileUpdate struct {
+	AccessToken string    `json:"access_token"`
+	DisplayName *string   `json:"display_name"`
+	Email       *string   `json:"email"`
+	Locale      *string   `json:"locale"`
+	Timezone    *string   `json:"timezone"`
+	Updated     time.Time `json:"updated"`
+	// CurrentPassword is required to change the email address, password
+	// resets are mailed there
+	CurrentPassword string `json:"current_password"`
+}
+
+// PasswordChange is sent by a signed in user, Password is the new password.
+type PasswordChange struct {
+	AccessToken     string `json:"access_token"`
+	CurrentPassword string `json:"current_password"`
+	Password        string `json:"password"`
+}
+
+// PasswordChangedEvent tells other services the password of a user changed,
+// Reason says whether they changed it themselves or reset it.
+type PasswordChangedEvent struct {
+	UserID    int       `json:"user_id"`
+	Reason    string    `json:"reason"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// PasswordResetRequest and EmailVerificationRequest take a username or an
+// email address in Name.
+type PasswordResetRequest struct {
+	Name string `json:"name"`
+}
+
+type PasswordResetConfirm struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// PasswordResetNotification asks the mailer to send the reset link. Token is
+// a secret, it must only end up in the mail.
+type PasswordResetNotification struct {
+	UserID    int       `json:"user_id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Locale    string    `json:"locale,omitempty"`
+	Token     string    `json:"token"`
+	Link      string    `json:"link,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type EmailVerificationRequest struct {
+	Name string `json:"name"`
+}
+
+type EmailVerificationConfirm struct {
+	Token string `json:"token"`
+}
+
+// EmailVerificationNotification asks the mailer to send the verification link
+// to the address being verified.
+type EmailVerificationNotification struct {
+	UserID    int       `json:"user_id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Locale    string    `json:"locale,omitempty"`
+	Token     string    `json:"token"`
+	Link      string    `json:"link,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// AccountDeletion needs the password on top of the access token
+type AccountDeletion struct {
+	AccessToken string `json:"access_token"`
+	Password    string `json:"password"`
+}
+
+type AccountRestore struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+// AccountDeletedEvent tells other services to hide the data of the user, it
+// is gone for good after PurgeAfter unless a user.restored event comes first.
+type AccountDeletedEvent struct {
+	UserID     int       `json:"user_id"`
+	DeletedAt  time.Time `json:"deleted_at"`
+	PurgeAfter time.Time `json:"purge_after"`
+}
+
+type AccountRestoredEvent struct {
+	UserID     int       `json:"user_id"`
+	RestoredAt time.Time `json:"restored_at"`
+}
+
+// AccountPurgedEvent tells other services to delete the data of the user
+type AccountPurgedEvent struct {
+	UserID     int       `json:"user_id"`
+	PurgedAt   time.Time `json:"purged_at"`
+	Anonymized bool      `json:"anonymized"`
+}
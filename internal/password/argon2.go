@@ -0,0 +1,111 @@
+package password
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"strings"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// argon2Hasher makes $argon2id$v=19$m=<KiB>,t=<iterations>,p=<parallelism>$<salt>$<hash>
+type argon2Hasher struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (h *argon2Hasher) Hash(password string) (string, error) {
+
+	if h.memory == 0 || h.iterations == 0 || h.parallelism == 0 {
+		return "", errors.New("argon2id parameters must be positive")
+	}
+
+	s, err := salt(argon2SaltLength)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), s, h.iterations, h.memory, h.parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.memory, h.iterations, h.parallelism,
+		base64.RawStdEncoding.EncodeToString(s),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *argon2Hasher) Identifies(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (h *argon2Hasher) Verify(encoded, password string) (bool, error) {
+
+	params, err := parseArgon2(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	key := argon2.IDKey([]byte(password), params.salt, params.iterations, params.memory, params.parallelism, uint32(len(params.key)))
+
+	return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+}
+
+func (h *argon2Hasher) Outdated(encoded string) bool {
+
+	params, err := parseArgon2(encoded)
+	if err != nil {
+		return true
+	}
+
+	return params.memory != h.memory || params.iterations != h.iterations ||
+		params.parallelism != h.parallelism || len(params.key) != argon2KeyLength
+}
+
+func parseArgon2(encoded string) (*argon2Params, error) {
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, ErrMalformedHash
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return nil, ErrMalformedHash
+	}
+
+	params := &argon2Params{}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism)
+	// argon2.IDKey panics on zero passes or lanes
+	if err != nil || params.memory == 0 || params.iterations == 0 || params.parallelism == 0 {
+		return nil, ErrMalformedHash
+	}
+
+	params.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, ErrMalformedHash
+	}
+
+	params.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(params.key) == 0 {
+		return nil, ErrMalformedHash
+	}
+
+	return params, nil
+}
@@ -0,0 +1,86 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// BreachedList holds the SHA-1 hashes of known breached passwords. The file
+// has one hash per line, so the "SHA1:count" download of Have I Been Pwned can
+// be used as is; filter it to the most common passwords to bound the memory.
+type BreachedList struct {
+	hashes [][sha1.Size]byte
+}
+
+func LoadBreachedList(path string) (*BreachedList, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	list := &BreachedList{}
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// drop the breach count
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			line = line[:i]
+		}
+
+		var hash [sha1.Size]byte
+		n, err := hex.Decode(hash[:], []byte(line))
+		if err != nil || n != sha1.Size {
+			return nil, fmt.Errorf("%s:%d: not a SHA-1 hash", path, lineNumber)
+		}
+
+		list.hashes = append(list.hashes, hash)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(list.hashes, func(i, j int) bool {
+		return bytes.Compare(list.hashes[i][:], list.hashes[j][:]) < 0
+	})
+
+	return list, nil
+}
+
+func (b *BreachedList) Len() int {
+	if b == nil {
+		return 0
+	}
+	return len(b.hashes)
+}
+
+// Contains reports whether the password is on the list, a nil list contains
+// nothing.
+func (b *BreachedList) Contains(password string) bool {
+
+	if b == nil {
+		return false
+	}
+
+	hash := sha1.Sum([]byte(password))
+
+	i := sort.Search(len(b.hashes), func(i int) bool {
+		return bytes.Compare(b.hashes[i][:], hash[:]) >= 0
+	})
+
+	return i < len(b.hashes) && b.hashes[i] == hash
+}
@@ -0,0 +1,119 @@
+package password
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"user/config"
+)
+
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmScrypt   = "scrypt"
+)
+
+var (
+	ErrUnknownHash     = errors.New("unknown password hash format")
+	ErrMalformedHash   = errors.New("malformed password hash")
+	ErrPasswordTooLong = errors.New("password too long for the hash algorithm")
+)
+
+// Hasher is one password hashing algorithm. Hashes are stored in the PHC
+// string format, bcrypt keeps its own "$2b$" format which the PHC format
+// grew out of.
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Identifies reports whether the hash was made by this algorithm
+	Identifies(encoded string) bool
+	Verify(encoded, password string) (bool, error)
+	// Outdated reports whether the hash was made with other parameters
+	Outdated(encoded string) bool
+}
+
+// Hashers hashes new passwords with the configured algorithm and verifies the
+// hashes of every known one, so that the stored hashes can be migrated on
+// sign-in.
+type Hashers struct {
+	preferred Hasher
+	all       []Hasher
+}
+
+func NewHashers(cfg config.PasswordCfg) (*Hashers, error) {
+
+	bcryptHasher, err := newBcryptHasher(cfg.BcryptCost)
+	if err != nil {
+		return nil, err
+	}
+
+	argon2Hasher := &argon2Hasher{
+		memory:      cfg.Argon2Memory,
+		iterations:  cfg.Argon2Iterations,
+		parallelism: cfg.Argon2Parallelism,
+	}
+
+	scryptHasher := &scryptHasher{
+		logN: cfg.ScryptLogN,
+		r:    cfg.ScryptR,
+		p:    cfg.ScryptP,
+	}
+
+	hashers := &Hashers{
+		all: []Hasher{bcryptHasher, argon2Hasher, scryptHasher},
+	}
+
+	switch cfg.HashAlgorithm {
+	case AlgorithmBcrypt:
+		hashers.preferred = bcryptHasher
+	case AlgorithmArgon2id:
+		hashers.preferred = argon2Hasher
+	case AlgorithmScrypt:
+		hashers.preferred = scryptHasher
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm %q", cfg.HashAlgorithm)
+	}
+
+	// fail at startup rather than on the first sign-up
+	_, err = hashers.preferred.Hash("check")
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s parameters: %w", cfg.HashAlgorithm, err)
+	}
+
+	return hashers, nil
+}
+
+func (h *Hashers) Hash(password string) (string, error) {
+	return h.preferred.Hash(password)
+}
+
+// Verify checks the password against a hash of any known algorithm. rehash is
+// set when the password matches but the hash is not what Hash would make now.
+func (h *Hashers) Verify(encoded, password string) (ok, rehash bool, err error) {
+
+	for _, hasher := range h.all {
+		if !hasher.Identifies(encoded) {
+			continue
+		}
+
+		ok, err = hasher.Verify(encoded, password)
+		if err != nil || !ok {
+			return false, false, err
+		}
+
+		return true, hasher != h.preferred || hasher.Outdated(encoded), nil
+	}
+
+	return false, false, ErrUnknownHash
+}
+
+func salt(size int) ([]byte, error) {
+
+	b := make([]byte, size)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
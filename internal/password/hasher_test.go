@@ -0,0 +1,213 @@
+package password
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"user/config"
+)
+
+// cheap parameters, the tests are about the encoding and not the cost
+func testPasswordCfg(algorithm string) config.PasswordCfg {
+	return config.PasswordCfg{
+		HashAlgorithm:     algorithm,
+		BcryptCost:        4,
+		Argon2Memory:      64,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+		ScryptLogN:        4,
+		ScryptR:           8,
+		ScryptP:           1,
+	}
+}
+
+func newTestHashers(t *testing.T, algorithm string) *Hashers {
+
+	hashers, err := NewHashers(testPasswordCfg(algorithm))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hashers
+}
+
+func TestHashFormat(t *testing.T) {
+
+	tests := []struct {
+		algorithm string
+		prefix    string
+		parts     int
+	}{
+		{AlgorithmArgon2id, "$argon2id$v=19$m=64,t=1,p=1$", 6},
+		{AlgorithmScrypt, "$scrypt$ln=4,r=8,p=1$", 5},
+		{AlgorithmBcrypt, "$2a$04$", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			hashers := newTestHashers(t, tt.algorithm)
+
+			encoded, err := hashers.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(encoded, tt.prefix) || len(strings.Split(encoded, "$")) != tt.parts {
+				t.Errorf("Hash() = %s, want %s...", encoded, tt.prefix)
+			}
+
+			again, err := hashers.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again == encoded {
+				t.Error("Hash() is not salted")
+			}
+
+			ok, rehash, err := hashers.Verify(encoded, "correct horse")
+			if err != nil || !ok || rehash {
+				t.Errorf("Verify() of the password = %v, %v, %v", ok, rehash, err)
+			}
+
+			ok, _, err = hashers.Verify(encoded, "wrong horse")
+			if err != nil || ok {
+				t.Errorf("Verify() of another password = %v, %v", ok, err)
+			}
+		})
+	}
+}
+
+// RFC 7914 section 12, in the PHC format
+func TestScryptVector(t *testing.T) {
+
+	key, err := hex.DecodeString("fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded := "$scrypt$ln=10,r=8,p=16$" +
+		base64.RawStdEncoding.EncodeToString([]byte("NaCl")) + "$" +
+		base64.RawStdEncoding.EncodeToString(key)
+
+	hasher := &scryptHasher{logN: 10, r: 8, p: 16}
+
+	ok, err := hasher.Verify(encoded, "password")
+	if err != nil || !ok {
+		t.Errorf("Verify() = %v, %v", ok, err)
+	}
+
+	// the vector derives 64 bytes, this service makes 32
+	if !hasher.Outdated(encoded) {
+		t.Error("Outdated() ignores the key length")
+	}
+}
+
+func TestRehash(t *testing.T) {
+
+	argon2Hash, _ := newTestHashers(t, AlgorithmArgon2id).Hash("pw")
+	scryptHash, _ := newTestHashers(t, AlgorithmScrypt).Hash("pw")
+	bcryptHash, _ := newTestHashers(t, AlgorithmBcrypt).Hash("pw")
+
+	stronger := testPasswordCfg(AlgorithmArgon2id)
+	stronger.Argon2Iterations = 2
+	strongerHashers, err := NewHashers(stronger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		hashers *Hashers
+		encoded string
+		rehash  bool
+	}{
+		{"same algorithm and parameters", newTestHashers(t, AlgorithmArgon2id), argon2Hash, false},
+		{"bcrypt to argon2id", newTestHashers(t, AlgorithmArgon2id), bcryptHash, true},
+		{"scrypt to argon2id", newTestHashers(t, AlgorithmArgon2id), scryptHash, true},
+		{"argon2id to bcrypt", newTestHashers(t, AlgorithmBcrypt), argon2Hash, true},
+		{"more iterations", strongerHashers, argon2Hash, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash, err := tt.hashers.Verify(tt.encoded, "pw")
+			if err != nil || !ok {
+				t.Fatalf("Verify() = %v, %v", ok, err)
+			}
+			if rehash != tt.rehash {
+				t.Errorf("Verify() rehash = %v, want %v", rehash, tt.rehash)
+			}
+		})
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+
+	hashers := newTestHashers(t, AlgorithmArgon2id)
+
+	tests := []struct {
+		name    string
+		encoded string
+		want    error
+	}{
+		{"unknown algorithm", "$md5$abc", ErrUnknownHash},
+		{"plaintext", "secret", ErrUnknownHash},
+		{"argon2id missing part", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA", ErrMalformedHash},
+		{"argon2id other version", "$argon2id$v=16$m=64,t=1,p=1$c2FsdA$a2V5", ErrMalformedHash},
+		{"argon2id bad parameters", "$argon2id$v=19$m=x,t=1,p=1$c2FsdA$a2V5", ErrMalformedHash},
+		{"argon2id zero memory", "$argon2id$v=19$m=0,t=1,p=1$c2FsdA$a2V5", ErrMalformedHash},
+		{"argon2id zero iterations", "$argon2id$v=19$m=64,t=0,p=1$c2FsdA$a2V5", ErrMalformedHash},
+		{"argon2id zero parallelism", "$argon2id$v=19$m=64,t=1,p=0$c2FsdA$a2V5", ErrMalformedHash},
+		{"argon2id bad salt", "$argon2id$v=19$m=64,t=1,p=1$c2Fsd!$a2V5", ErrMalformedHash},
+		{"argon2id empty key", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA$", ErrMalformedHash},
+		{"scrypt huge cost", "$scrypt$ln=63,r=8,p=1$c2FsdA$a2V5", ErrMalformedHash},
+		{"scrypt bad parameters", "$scrypt$n=4,r=8,p=1$c2FsdA$a2V5", ErrMalformedHash},
+		{"scrypt zero block size", "$scrypt$ln=4,r=0,p=1$c2FsdA$a2V5", ErrMalformedHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, _, err := hashers.Verify(tt.encoded, "pw")
+			if ok || !errors.Is(err, tt.want) {
+				t.Errorf("Verify() = %v, %v, want %v", ok, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewHashersRejects(t *testing.T) {
+
+	unknown := testPasswordCfg("md5")
+
+	bcryptCost := testPasswordCfg(AlgorithmBcrypt)
+	bcryptCost.BcryptCost = 40
+
+	argon2Memory := testPasswordCfg(AlgorithmArgon2id)
+	argon2Memory.Argon2Memory = 0
+
+	scryptR := testPasswordCfg(AlgorithmScrypt)
+	scryptR.ScryptR = 0
+
+	for name, cfg := range map[string]config.PasswordCfg{
+		"unknown algorithm": unknown,
+		"bcrypt cost":       bcryptCost,
+		"argon2id memory":   argon2Memory,
+		"scrypt block size": scryptR,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewHashers(cfg)
+			if err == nil {
+				t.Error("NewHashers() succeeded")
+			}
+		})
+	}
+}
+
+func TestBcryptTooLong(t *testing.T) {
+
+	_, err := newTestHashers(t, AlgorithmBcrypt).Hash(strings.Repeat("x", 73))
+	if !errors.Is(err, ErrPasswordTooLong) {
+		t.Errorf("Hash() = %v, want ErrPasswordTooLong", err)
+	}
+}
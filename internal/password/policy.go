@@ -0,0 +1,98 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"user/config"
+	"user/internal/validation"
+)
+
+// Policy decides which passwords may be set. It applies to every path that
+// stores a new password, sign-up included.
+type Policy struct {
+	cfg      config.PasswordCfg
+	breached *BreachedList
+	maxBytes int
+}
+
+func NewPolicy(cfg config.PasswordCfg) (*Policy, error) {
+
+	policy := &Policy{cfg: cfg}
+
+	if cfg.HashAlgorithm == AlgorithmBcrypt {
+		policy.maxBytes = 72
+	}
+
+	if cfg.BreachedListFile != "" {
+		breached, err := LoadBreachedList(cfg.BreachedListFile)
+		if err != nil {
+			return nil, err
+		}
+		policy.breached = breached
+	}
+
+	return policy, nil
+}
+
+func (p *Policy) BreachedCount() int {
+	return p.breached.Len()
+}
+
+// Check returns validation.Errors on the password field listing every rule the
+// password breaks.
+func (p *Policy) Check(userName, password string) error {
+
+	var errs validation.Errors
+
+	fail := func(message string) {
+		errs = append(errs, validation.FieldError{Field: "password", Message: message})
+	}
+
+	if utf8.RuneCountInString(password) < p.cfg.MinLength {
+		fail(fmt.Sprintf("must be at least %d characters", p.cfg.MinLength))
+	}
+
+	if p.maxBytes > 0 && len(password) > p.maxBytes {
+		fail(fmt.Sprintf("must be at most %d bytes", p.maxBytes))
+	}
+
+	if classes(password) < p.cfg.MinClasses {
+		fail("needs more kinds of characters: lowercase, uppercase, digits, symbols")
+	}
+
+	if userName != "" && strings.EqualFold(password, userName) {
+		fail("must differ from the username")
+	}
+
+	if p.breached.Contains(password) {
+		fail("appears in a known data breach")
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+func classes(password string) int {
+
+	var lower, upper, digit, other int
+
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+
+	return lower + upper + digit + other
+}
@@ -0,0 +1,123 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"user/config"
+	"user/internal/validation"
+)
+
+func writeBreachedList(t *testing.T, lines ...string) string {
+
+	path := filepath.Join(t.TempDir(), "breached.txt")
+
+	err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func TestPolicyCheck(t *testing.T) {
+
+	cfg := config.PasswordCfg{
+		MinLength:     8,
+		MinClasses:    3,
+		HashAlgorithm: AlgorithmArgon2id,
+		BreachedListFile: writeBreachedList(t,
+			"# most common first",
+			sha1Hex("Password1")+":24230577",
+			sha1Hex("Qwerty123!"),
+		),
+	}
+
+	policy, err := NewPolicy(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bcryptCfg := cfg
+	bcryptCfg.HashAlgorithm = AlgorithmBcrypt
+	bcryptCfg.BreachedListFile = ""
+
+	bcryptPolicy, err := NewPolicy(bcryptCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		policy   *Policy
+		userName string
+		password string
+		want     []string
+	}{
+		{"strong", policy, "alice", "Tr0ub4dor&3", nil},
+		{"too short", policy, "alice", "Ab1!", []string{"must be at least 8 characters"}},
+		// length is counted in characters, not bytes
+		{"multibyte characters", policy, "alice", "äöüÄÖÜ12", nil},
+		{"too few classes", policy, "alice", "abcdefgh12", []string{"needs more kinds of characters: lowercase, uppercase, digits, symbols"}},
+		{"username", policy, "Alice.Smith1", "alice.smith1", []string{"must differ from the username"}},
+		{"breached", policy, "alice", "Password1", []string{"appears in a known data breach"}},
+		{"breached without count", policy, "alice", "Qwerty123!", []string{"appears in a known data breach"}},
+		{"every rule", policy, "pass", "pass", []string{
+			"must be at least 8 characters",
+			"needs more kinds of characters: lowercase, uppercase, digits, symbols",
+			"must differ from the username",
+		}},
+		{"bcrypt byte limit", bcryptPolicy, "alice", "Aa1!" + strings.Repeat("x", 69), []string{"must be at most 72 bytes"}},
+		{"bcrypt at the limit", bcryptPolicy, "alice", "Aa1!" + strings.Repeat("x", 68), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(tt.userName, tt.password)
+
+			var messages []string
+			if err != nil {
+				errs, ok := err.(validation.Errors)
+				if !ok {
+					t.Fatalf("Check() = %v, not validation.Errors", err)
+				}
+				for _, fieldErr := range errs {
+					if fieldErr.Field != "password" {
+						t.Errorf("error on field %s", fieldErr.Field)
+					}
+					messages = append(messages, fieldErr.Message)
+				}
+			}
+
+			if !reflect.DeepEqual(messages, tt.want) {
+				t.Errorf("Check() = %q, want %q", messages, tt.want)
+			}
+		})
+	}
+
+	if policy.BreachedCount() != 2 || bcryptPolicy.BreachedCount() != 0 {
+		t.Errorf("BreachedCount() = %d and %d", policy.BreachedCount(), bcryptPolicy.BreachedCount())
+	}
+}
+
+func TestLoadBreachedListRejects(t *testing.T) {
+
+	_, err := LoadBreachedList(writeBreachedList(t, sha1Hex("x"), "not a hash"))
+	if err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("LoadBreachedList() = %v, want an error on line 2", err)
+	}
+
+	_, err = LoadBreachedList(filepath.Join(t.TempDir(), "missing.txt"))
+	if err == nil {
+		t.Error("LoadBreachedList() of a missing file succeeded")
+	}
+}
@@ -0,0 +1,110 @@
+package password
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/scrypt"
+	"strings"
+)
+
+const (
+	scryptSaltLength = 16
+	scryptKeyLength  = 32
+)
+
+// scryptHasher makes $scrypt$ln=<log2 N>,r=<block size>,p=<parallelism>$<salt>$<hash>
+type scryptHasher struct {
+	logN int
+	r    int
+	p    int
+}
+
+type scryptParams struct {
+	logN int
+	r    int
+	p    int
+	salt []byte
+	key  []byte
+}
+
+func (h *scryptHasher) Hash(password string) (string, error) {
+
+	// scrypt.Key divides by r*p
+	if h.r <= 0 || h.p <= 0 {
+		return "", errors.New("scrypt parameters must be positive")
+	}
+
+	s, err := salt(scryptSaltLength)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := scrypt.Key([]byte(password), s, 1<<h.logN, h.r, h.p, scryptKeyLength)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s",
+		h.logN, h.r, h.p,
+		base64.RawStdEncoding.EncodeToString(s),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *scryptHasher) Identifies(encoded string) bool {
+	return strings.HasPrefix(encoded, "$scrypt$")
+}
+
+func (h *scryptHasher) Verify(encoded, password string) (bool, error) {
+
+	params, err := parseScrypt(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	key, err := scrypt.Key([]byte(password), params.salt, 1<<params.logN, params.r, params.p, len(params.key))
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+}
+
+func (h *scryptHasher) Outdated(encoded string) bool {
+
+	params, err := parseScrypt(encoded)
+	if err != nil {
+		return true
+	}
+
+	return params.logN != h.logN || params.r != h.r || params.p != h.p || len(params.key) != scryptKeyLength
+}
+
+func parseScrypt(encoded string) (*scryptParams, error) {
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 || parts[1] != "scrypt" {
+		return nil, ErrMalformedHash
+	}
+
+	params := &scryptParams{}
+
+	_, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &params.logN, &params.r, &params.p)
+	if err != nil || params.logN <= 0 || params.logN >= 63 || params.r <= 0 || params.p <= 0 {
+		return nil, ErrMalformedHash
+	}
+
+	params.salt, err = base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, ErrMalformedHash
+	}
+
+	params.key, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(params.key) == 0 {
+		return nil, ErrMalformedHash
+	}
+
+	return params, nil
+}
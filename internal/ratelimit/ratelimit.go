@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"github.com/go-redis/redis"
+	"github.com/twinj/uuid"
+	"time"
+	"user/config"
+)
+
+// sliding window log: one sorted set entry per request, scored by its time in
+// milliseconds. Returns 0 when the request is allowed, otherwise the
+// milliseconds until the oldest request leaves the window.
+var slidingWindow = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+
+if redis.call('ZCARD', key) < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	redis.call('PEXPIRE', key, window)
+	return 0
+end
+
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+return tonumber(oldest[2]) + window - now
+`)
+
+type Limiter struct {
+	redis *redis.Client
+	cfg   config.RateLimitCfg
+}
+
+func NewLimiter(redis *redis.Client, cfg config.RateLimitCfg) *Limiter {
+	return &Limiter{
+		redis: redis,
+		cfg:   cfg,
+	}
+}
+
+// limit of the subject, a subject without its own limit gets the default
+func (l *Limiter) limit(subject string) config.Limit {
+	if limit, ok := l.cfg.Subjects[subject]; ok {
+		return limit
+	}
+	return l.cfg.Default
+}
+
+// Allow counts a request of the caller on the subject. It returns how long the
+// caller has to wait when over the limit, zero otherwise.
+func (l *Limiter) Allow(subject, identity string) (time.Duration, error) {
+
+	limit := l.limit(subject)
+	if limit.Requests <= 0 || limit.Window <= 0 {
+		return 0, nil
+	}
+
+	key := "rate_limit:" + subject + ":" + identity
+	now := time.Now().UnixMilli()
+
+	wait, err := slidingWindow.Run(l.redis, []string{key},
+		now, limit.Window.Milliseconds(), limit.Requests, uuid.NewV4().String(),
+	).Int64()
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(wait) * time.Millisecond, nil
+}
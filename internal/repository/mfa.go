@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"user/internal/logging"
+	"user/internal/model"
+)
+
+var ErrMFANotFound = errors.New("mfa not found")
+
+type MFARepository struct {
+	DbConn *pgxpool.Pool
+	Logger *logging.Logger
+}
+
+func NewMFARepository(db *pgxpool.Pool, log *logging.Logger) *MFARepository {
+	return &MFARepository{
+		DbConn: db,
+		Logger: log,
+	}
+}
+
+func (r *MFARepository) GetMFA(userID int) (*model.MFA, error) {
+
+	mfa := &model.MFA{}
+
+	sqlQuery := "SELECT user_id, secret, enabled, last_used_step, created, confirmed FROM user_mfa WHERE user_id = $1"
+
+	err := r.DbConn.QueryRow(context.Background(), sqlQuery, userID).Scan(
+		&mfa.UserID, &mfa.Secret, &mfa.Enabled, &mfa.LastUsedStep, &mfa.Created, &mfa.Confirmed,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrMFANotFound
+	}
+	if err != nil {
+		r.Logger.Error(err)
+		return nil, err
+	}
+
+	return mfa, nil
+}
+
+// SaveMFASecret starts or restarts an enrolment. It reports false and keeps
+// the row when MFA is already enabled.
+func (r *MFARepository) SaveMFASecret(userID int, secret []byte) (bool, error) {
+
+	sqlQuery := `INSERT INTO user_mfa (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_used_step = 0, created = current_timestamp
+		WHERE user_mfa.enabled = false`
+
+	tag, err := r.DbConn.Exec(context.Background(), sqlQuery, userID, secret)
+	if err != nil {
+		r.Logger.Error(err)
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// EnableMFA confirms the enrolment with the given secret. It reports false
+// when the enrolment was confirmed or restarted by another request meanwhile.
+func (r *MFARepository) EnableMFA(userID int, secret []byte, step int64) (bool, error) {
+
+	sqlQuery := `UPDATE user_mfa SET enabled = true, confirmed = current_timestamp, last_used_step = $3
+		WHERE user_id = $1 AND secret = $2 AND enabled = false`
+
+	tag, err := r.DbConn.Exec(context.Background(), sqlQuery, userID, secret, step)
+	if err != nil {
+		r.Logger.Error(err)
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// UseMFAStep records the step of an accepted code. It reports false when this
+// or a later step was used already, so a code works only once.
+func (r *MFARepository) UseMFAStep(userID int, step int64) (bool, error) {
+
+	sqlQuery := "UPDATE user_mfa SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2"
+
+	tag, err := r.DbConn.Exec(context.Background(), sqlQuery, userID, step)
+	if err != nil {
+		r.Logger.Error(err)
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// DeleteMFA drops the enrolment together with its recovery codes
+func (r *MFARepository) DeleteMFA(userID int) error {
+
+	sqlQuery := "DELETE FROM user_mfa WHERE user_id = $1"
+
+	_, err := r.DbConn.Exec(context.Background(), sqlQuery, userID)
+	if err != nil {
+		r.Logger.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes swaps all codes of the user at once, the old ones stop
+// working together.
+func (r *MFARepository) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+
+	ctx := context.Background()
+
+	tx, err := r.DbConn.Begin(ctx)
+	if err != nil {
+		r.Logger.Error(err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1", userID)
+	if err != nil {
+		r.Logger.Error(err)
+		return err
+	}
+
+	for _, codeHash := range codeHashes {
+		_, err = tx.Exec(ctx, "INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, codeHash)
+		if err != nil {
+			r.Logger.Error(err)
+			return err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		r.Logger.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks an unused code as used, it reports false for unknown
+// and used codes.
+func (r *MFARepository) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+
+	sqlQuery := "UPDATE user_recovery_codes SET used = current_timestamp WHERE user_id = $1 AND code_hash = $2 AND used IS NULL"
+
+	tag, err := r.DbConn.Exec(context.Background(), sqlQuery, userID, codeHash)
+	if err != nil {
+		r.Logger.Error(err)
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *MFARepository) CountRecoveryCodes(userID int) (int, error) {
+
+	var count int
+
+	sqlQuery := "SELECT count(*) FROM user_recovery_codes WHERE user_id = $1 AND used IS NULL"
+
+	err := r.DbConn.QueryRow(context.Background(), sqlQuery, userID).Scan(&count)
+	if err != nil {
+		r.Logger.Error(err)
+		return 0, err
+	}
+
+	return count, nil
+}
@@ -1,7 +1,8 @@
 package repository
 
 import (
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
 	"user/internal/logging"
 	"user/internal/model"
 )
@@ -9,15 +10,40 @@ import (
 type User interface {
 	CreateUser(u *model.User) (int, error)
 	GetUser(u *model.User) (*model.User, error)
+	GetUserByID(userID int) (*model.User, error)
+	GetUserByEmail(email string) (*model.User, error)
 	ExistsUser(userName string) (bool, error)
+	ExistsEmail(email string) (bool, error)
+	VerifyEmail(userID int, email string) (bool, error)
+	UpdatePasswordHash(userID int, oldHash, newHash string) (bool, error)
+	ChangePassword(userID int, oldHash, newHash string) (bool, error)
+	GetProfile(userID int) (*model.Profile, error)
+	UpdateProfile(p *model.Profile, expected time.Time) (bool, error)
+	SoftDeleteUser(userID int) (time.Time, bool, error)
+	GetDeletedUser(userName string, since time.Time) (*model.User, error)
+	RestoreUser(userID int, since time.Time) (bool, error)
+	PurgeDeletedUsers(before time.Time, anonymize bool) ([]int, error)
+}
+
+type MFA interface {
+	GetMFA(userID int) (*model.MFA, error)
+	SaveMFASecret(userID int, secret []byte) (bool, error)
+	EnableMFA(userID int, secret []byte, step int64) (bool, error)
+	UseMFAStep(userID int, step int64) (bool, error)
+	DeleteMFA(userID int) error
+	ReplaceRecoveryCodes(userID int, codeHashes []string) error
+	UseRecoveryCode(userID int, codeHash string) (bool, error)
+	CountRecoveryCodes(userID int) (int, error)
 }
 
 type Repository struct {
 	User
+	MFA
 }
 
-func NewRepository(db *pgx.Conn, log *logging.Logger) *Repository {
+func NewRepository(db *pgxpool.Pool, log *logging.Logger) *Repository {
 	return &Repository{
 		User: NewUserRepository(db, log),
+		MFA:  NewMFARepository(db, log),
 	}
 }
@@ -2,18 +2,58 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"time"
 	"user/internal/logging"
 	"user/internal/model"
 )
 
+var (
+	ErrUserNotFound = errors.New("user not found")
+	// ErrEmailTaken means another user has the address, in any letter case
+	ErrEmailTaken = errors.New("email address taken")
+	// ErrNameTaken means an active user has the name
+	ErrNameTaken = errors.New("user name taken")
+)
+
+const userColumns = "id, name, password, email, email_verified_at, created, updated"
+
+func scanUser(row pgx.Row) (*model.User, error) {
+
+	user := &model.User{}
+
+	err := row.Scan(&user.ID, &user.Name, &user.Password, &user.Email, &user.EmailVerifiedAt, &user.Created, &user.Updated)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// emailTaken tells a violation of the unique index on lower(email)
+func emailTaken(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "users_email_lower_idx"
+}
+
+// nameTaken tells a violation of the unique index on the names of active users
+func nameTaken(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "users_name_active_idx"
+}
+
 type UserRepository struct {
-	DbConn *pgx.Conn
+	DbConn *pgxpool.Pool
 	Logger *logging.Logger
 }
 
-func NewUserRepository(db *pgx.Conn, log *logging.Logger) *UserRepository {
+func NewUserRepository(db *pgxpool.Pool, log *logging.Logger) *UserRepository {
 	return &UserRepository{
 		DbConn: db,
 		Logger: log,
@@ -24,9 +64,15 @@ func (r *UserRepository) CreateUser(u *model.User) (int, error) {
 
 	var id int
 
-	sqlQuery := "INSERT INTO users (name, password) VALUES ($1, $2) RETURNING id"
+	sqlQuery := "INSERT INTO users (name, password, email) VALUES ($1, $2, $3) RETURNING id"
 
-	err := r.DbConn.QueryRow(context.Background(), sqlQuery, u.Name, u.Password).Scan(&id)
+	err := r.DbConn.QueryRow(context.Background(), sqlQuery, u.Name, u.Password, u.Email).Scan(&id)
+	if emailTaken(err) {
+		return 0, ErrEmailTaken
+	}
+	if nameTaken(err) {
+		return 0, ErrNameTaken
+	}
 	if err != nil {
 		r.Logger.Error(err)
 		return 0, err
@@ -37,39 +83,75 @@ func (r *UserRepository) CreateUser(u *model.User) (int, error) {
 
 func (r *UserRepository) GetUser(u *model.User) (*model.User, error) {
 
-	var (
-		id       int
-		name     string
-		password string
-		created  time.Time
-		updated  time.Time
-	)
+	sqlQuery := "SELECT " + userColumns + " FROM users WHERE name = $1 AND deleted_at IS NULL"
+
+	user, err := scanUser(r.DbConn.QueryRow(context.Background(), sqlQuery, u.Name))
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		r.Logger.Error(err)
+	}
+
+	return user, err
+}
+
+func (r *UserRepository) GetUserByEmail(email string) (*model.User, error) {
+
+	sqlQuery := "SELECT " + userColumns + " FROM users WHERE lower(email) = lower($1) AND email <> '' AND deleted_at IS NULL"
+
+	user, err := scanUser(r.DbConn.QueryRow(context.Background(), sqlQuery, email))
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		r.Logger.Error(err)
+	}
+
+	return user, err
+}
+
+func (r *UserRepository) GetUserByID(userID int) (*model.User, error) {
 
-	//sqlQuery := "SELECT * FROM users WHERE name = $1 and password = $2"
-	sqlQuery := "SELECT * FROM users WHERE name = $1"
+	sqlQuery := "SELECT " + userColumns + " FROM users WHERE id = $1 AND deleted_at IS NULL"
 
-	err := r.DbConn.QueryRow(context.Background(), sqlQuery, u.Name).Scan(&id, &name, &password, &created, &updated)
+	user, err := scanUser(r.DbConn.QueryRow(context.Background(), sqlQuery, userID))
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		r.Logger.Error(err)
+	}
+
+	return user, err
+}
+
+func (r *UserRepository) ExistsEmail(email string) (bool, error) {
+
+	var exists bool
+
+	sqlQuery := "SELECT EXISTS (SELECT 1 FROM users WHERE lower(email) = lower($1) AND email <> '' AND deleted_at IS NULL)"
+
+	err := r.DbConn.QueryRow(context.Background(), sqlQuery, email).Scan(&exists)
 	if err != nil {
 		r.Logger.Error(err)
-		return nil, err
+		return true, err
 	}
 
-	user := &model.User{
-		ID:       id,
-		Name:     name,
-		Password: password,
-		Created:  created,
-		Updated:  updated,
+	return exists, nil
+}
+
+// VerifyEmail marks the address verified if the user still has it. false
+// means it was changed since the verification was sent.
+func (r *UserRepository) VerifyEmail(userID int, email string) (bool, error) {
+
+	sqlQuery := "UPDATE users SET email_verified_at = now() WHERE id = $1 AND lower(email) = lower($2) AND email <> '' AND deleted_at IS NULL"
+
+	tag, err := r.DbConn.Exec(context.Background(), sqlQuery, userID, email)
+	if err != nil {
+		r.Logger.Error(err)
+		return false, err
 	}
 
-	return user, nil
+	return tag.RowsAffected() == 1, nil
 }
 
 func (r *UserRepository) ExistsUser(userName string) (bool, error) {
 
 	var exists bool
 
-	sqlQuery := "SELECT EXISTS (SELECT 1 FROM users WHERE name = $1)"
+	sqlQuery := "SELECT EXISTS (SELECT 1 FROM users WHERE name = $1 AND deleted_at IS NULL)"
 
 	err := r.DbConn.QueryRow(context.Background(), sqlQuery, userName).Scan(&exists)
 	if err != nil {
@@ -79,3 +161,186 @@ func (r *UserRepository) ExistsUser(userName string) (bool, error) {
 
 	return exists, nil
 }
+
+// UpdatePasswordHash swaps the hash of an unchanged password, a password changed
+// in the meantime is left alone. updated is kept, the password stays the same.
+func (r *UserRepository) UpdatePasswordHash(userID int, oldHash, newHash string) (bool, error) {
+
+	sqlQuery := "UPDATE users SET password = $1 WHERE id = $2 AND password = $3"
+
+	tag, err := r.DbConn.Exec(context.Background(), sqlQuery, newHash, userID, oldHash)
+	if err != nil {
+		r.Logger.Error(err)
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// ChangePassword sets a new password if the old hash is still in place, a
+// concurrent change or rehash wins. Unlike UpdatePasswordHash it bumps updated.
+func (r *UserRepository) ChangePassword(userID int, oldHash, newHash string) (bool, error) {
+
+	sqlQuery := "UPDATE users SET password = $1, updated = now() WHERE id = $2 AND password = $3 AND deleted_at IS NULL"
+
+	tag, err := r.DbConn.Exec(context.Background(), sqlQuery, newHash, userID, oldHash)
+	if err != nil {
+		r.Logger.Error(err)
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *UserRepository) GetProfile(userID int) (*model.Profile, error) {
+
+	p := &model.Profile{}
+
+	sqlQuery := "SELECT id, name, display_name, email, email_verified_at, locale, timezone, created, updated FROM users WHERE id = $1 AND deleted_at IS NULL"
+
+	err := r.DbConn.QueryRow(context.Background(), sqlQuery, userID).Scan(
+		&p.UserID, &p.Name, &p.DisplayName, &p.Email, &p.EmailVerifiedAt, &p.Locale, &p.Timezone, &p.Created, &p.Updated,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		r.Logger.Error(err)
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// UpdateProfile writes the profile only if its updated column still holds
+// expected, and then sets p.Updated to the new version. false means the row was
+// changed or deleted in the meantime. A new email address is unverified, a
+// change of letter case only keeps the verification.
+func (r *UserRepository) UpdateProfile(p *model.Profile, expected time.Time) (bool, error) {
+
+	sqlQuery := `UPDATE users SET display_name = $1, email = $2, locale = $3, timezone = $4, updated = now(),
+		email_verified_at = CASE WHEN lower(email) = lower($2) THEN email_verified_at END
+		WHERE id = $5 AND updated = $6 AND deleted_at IS NULL RETURNING email_verified_at, updated`
+
+	err := r.DbConn.QueryRow(context.Background(), sqlQuery,
+		p.DisplayName, p.Email, p.Locale, p.Timezone, p.UserID, expected,
+	).Scan(&p.EmailVerifiedAt, &p.Updated)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if emailTaken(err) {
+		return false, ErrEmailTaken
+	}
+	if err != nil {
+		r.Logger.Error(err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// SoftDeleteUser hides the user until they are restored or purged. false
+// means they were already deleted.
+func (r *UserRepository) SoftDeleteUser(userID int) (time.Time, bool, error) {
+
+	var deletedAt time.Time
+
+	sqlQuery := "UPDATE users SET deleted_at = now(), updated = now() WHERE id = $1 AND deleted_at IS NULL RETURNING deleted_at"
+
+	err := r.DbConn.QueryRow(context.Background(), sqlQuery, userID).Scan(&deletedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		r.Logger.Error(err)
+		return time.Time{}, false, err
+	}
+
+	return deletedAt, true, nil
+}
+
+// GetDeletedUser returns the latest user of that name deleted after since and
+// not purged yet.
+func (r *UserRepository) GetDeletedUser(userName string, since time.Time) (*model.User, error) {
+
+	sqlQuery := "SELECT " + userColumns + ` FROM users
+		WHERE name = $1 AND deleted_at > $2 AND purged_at IS NULL ORDER BY deleted_at DESC LIMIT 1`
+
+	user, err := scanUser(r.DbConn.QueryRow(context.Background(), sqlQuery, userName, since))
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		r.Logger.Error(err)
+	}
+
+	return user, err
+}
+
+// RestoreUser undoes a deletion made after since. false means the grace period
+// is over or the user is not deleted.
+func (r *UserRepository) RestoreUser(userID int, since time.Time) (bool, error) {
+
+	sqlQuery := "UPDATE users SET deleted_at = NULL, updated = now() WHERE id = $1 AND deleted_at > $2 AND purged_at IS NULL"
+
+	tag, err := r.DbConn.Exec(context.Background(), sqlQuery, userID, since)
+	if emailTaken(err) {
+		return false, ErrEmailTaken
+	}
+	if nameTaken(err) {
+		return false, ErrNameTaken
+	}
+	if err != nil {
+		r.Logger.Error(err)
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// PurgeDeletedUsers removes the users deleted before the given time and
+// returns their ids. With anonymize the row stays, stripped of everything
+// personal, for the foreign keys of other tables; the MFA data goes either way.
+func (r *UserRepository) PurgeDeletedUsers(before time.Time, anonymize bool) ([]int, error) {
+
+	ctx := context.Background()
+
+	sqlQuery := "DELETE FROM users WHERE deleted_at < $1 RETURNING id"
+	if anonymize {
+		sqlQuery = `UPDATE users SET name = 'deleted-' || id, password = '', email = '', email_verified_at = NULL,
+			display_name = '', locale = '', timezone = '', purged_at = now()
+			WHERE deleted_at < $1 AND purged_at IS NULL RETURNING id`
+	}
+
+	tx, err := r.DbConn.Begin(ctx)
+	if err != nil {
+		r.Logger.Error(err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, sqlQuery, before)
+	if err != nil {
+		r.Logger.Error(err)
+		return nil, err
+	}
+
+	userIDs, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		r.Logger.Error(err)
+		return nil, err
+	}
+
+	if anonymize && len(userIDs) > 0 {
+		_, err = tx.Exec(ctx, "DELETE FROM user_mfa WHERE user_id = ANY($1)", userIDs)
+		if err != nil {
+			r.Logger.Error(err)
+			return nil, err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		r.Logger.Error(err)
+		return nil, err
+	}
+
+	return userIDs, nil
+}
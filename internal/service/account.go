@@ -0,0 +1,173 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+	"user/config"
+	"user/internal/logging"
+	"user/internal/model"
+	"user/internal/repository"
+)
+
+const (
+	SubjectAccountDeleted  = "user.deleted"
+	SubjectAccountRestored = "user.restored"
+	SubjectAccountPurged   = "user.purged"
+)
+
+type AccountService struct {
+	rep       *repository.Repository
+	logger    *logging.Logger
+	users     *UserService
+	tokens    Token
+	cfg       config.AccountCfg
+	publisher Publisher
+}
+
+func NewAccountService(rep *repository.Repository, log *logging.Logger, users *UserService, tokens Token, cfg config.AccountCfg, publisher Publisher) *AccountService {
+	return &AccountService{
+		rep:       rep,
+		logger:    log,
+		users:     users,
+		tokens:    tokens,
+		cfg:       cfg,
+		publisher: publisher,
+	}
+}
+
+// DeleteAccount hides the user and signs them out everywhere. The row stays
+// until the grace period is over, so the account can still be restored.
+func (s *AccountService) DeleteAccount(userID int, password string) error {
+
+	user, err := s.rep.GetUserByID(userID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return ErrTokenRevoked
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	err = s.users.verifyPassword(user, password)
+	if err != nil {
+		return err
+	}
+
+	deletedAt, deleted, err := s.rep.SoftDeleteUser(userID)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	if !deleted {
+		return ErrTokenRevoked
+	}
+
+	s.logger.Infof("user %d deleted", userID)
+
+	err = s.tokens.RevokeUserTokens(userID)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	s.publish(SubjectAccountDeleted, model.AccountDeletedEvent{
+		UserID:     userID,
+		DeletedAt:  deletedAt.UTC(),
+		PurgeAfter: deletedAt.Add(s.cfg.GracePeriod).UTC(),
+	})
+
+	return nil
+}
+
+// RestoreAccount brings back an account deleted within the grace period. An
+// unknown name and a wrong password give the same error, as on sign-in.
+func (s *AccountService) RestoreAccount(name, password string) error {
+
+	user, err := s.rep.GetDeletedUser(name, time.Now().Add(-s.cfg.GracePeriod))
+	if errors.Is(err, repository.ErrUserNotFound) {
+		_, _, _ = s.users.hashers.Verify(s.users.dummyHash(), password)
+		return ErrInvalidCredentials
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	err = s.users.verifyPassword(user, password)
+	if err != nil {
+		return err
+	}
+
+	// the name was free while the account was deleted, the check is only a
+	// shortcut, the unique index on active names decides under races
+	exists, err := s.rep.ExistsUser(user.Name)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	if exists {
+		return ErrUserExists
+	}
+
+	restored, err := s.rep.RestoreUser(user.ID, time.Now().Add(-s.cfg.GracePeriod))
+	if errors.Is(err, repository.ErrEmailTaken) {
+		return ErrEmailExists
+	}
+	if errors.Is(err, repository.ErrNameTaken) {
+		return ErrUserExists
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	if !restored {
+		return ErrInvalidCredentials
+	}
+
+	s.logger.Infof("user %d restored", user.ID)
+
+	s.publish(SubjectAccountRestored, model.AccountRestoredEvent{
+		UserID:     user.ID,
+		RestoredAt: time.Now().UTC(),
+	})
+
+	return nil
+}
+
+// PurgeDeletedAccounts removes the accounts whose grace period is over and
+// returns how many there were.
+func (s *AccountService) PurgeDeletedAccounts() (int, error) {
+
+	userIDs, err := s.rep.PurgeDeletedUsers(time.Now().Add(-s.cfg.GracePeriod), s.cfg.Anonymize)
+	if err != nil {
+		s.logger.Error(err)
+		return 0, err
+	}
+
+	purgedAt := time.Now().UTC()
+
+	for _, userID := range userIDs {
+		s.publish(SubjectAccountPurged, model.AccountPurgedEvent{
+			UserID:     userID,
+			PurgedAt:   purgedAt,
+			Anonymized: s.cfg.Anonymize,
+		})
+	}
+
+	return len(userIDs), nil
+}
+
+func (s *AccountService) publish(subject string, event interface{}) {
+
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		s.logger.Error(err)
+		return
+	}
+
+	err = s.publisher.Publish(subject, eventBytes)
+	if err != nil {
+		s.logger.Error(err)
+	}
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-redis/redis"
+	"time"
+	"user/config"
+	"user/internal/logging"
+	"user/internal/model"
+	"user/internal/repository"
+)
+
+const SubjectEmailVerificationNotification = "notifications.email-verification"
+
+type EmailService struct {
+	rep       *repository.Repository
+	logger    *logging.Logger
+	links     *singleUseTokens
+	users     *UserService
+	cfg       config.EmailCfg
+	publisher Publisher
+}
+
+func NewEmailService(rep *repository.Repository, log *logging.Logger, redis *redis.Client, users *UserService, cfg config.EmailCfg, publisher Publisher) *EmailService {
+	return &EmailService{
+		rep:       rep,
+		logger:    log,
+		links:     newSingleUseTokens(redis, "email_verification", cfg.TokenTTL),
+		users:     users,
+		cfg:       cfg,
+		publisher: publisher,
+	}
+}
+
+// SendEmailVerification mails a verification link to the current address of
+// the user. Nothing is sent when there is no address or it is verified.
+func (s *EmailService) SendEmailVerification(userID int) error {
+
+	profile, err := s.rep.GetProfile(userID)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	if profile.Email == "" || profile.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	expiresAt := time.Now().Add(s.cfg.TokenTTL)
+
+	// the address is stored with the token, a link for an address the user
+	// has replaced since must not verify the new one
+	token, err := s.links.issue(userID, map[string]interface{}{
+		"email": profile.Email,
+	})
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	notification := model.EmailVerificationNotification{
+		UserID:    userID,
+		Name:      profile.Name,
+		Email:     profile.Email,
+		Locale:    profile.Locale,
+		Token:     token,
+		Link:      tokenLink(s.cfg.LinkURL, token),
+		ExpiresAt: expiresAt.UTC(),
+	}
+
+	notificationBytes, err := json.Marshal(notification)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	err = s.publisher.Publish(SubjectEmailVerificationNotification, notificationBytes)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	s.logger.Infof("email verification sent for user %d", userID)
+
+	return nil
+}
+
+// RequestEmailVerification sends the link again to a user who can't sign in
+// yet. Like a password reset it never tells whether the user exists.
+func (s *EmailService) RequestEmailVerification(name string) error {
+
+	user, err := s.users.findUser(name)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	return s.SendEmailVerification(user.ID)
+}
+
+func (s *EmailService) ConfirmEmailVerification(token string) error {
+
+	userID, values, err := s.links.lookup(token)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	if userID == 0 {
+		return ErrVerificationTokenInvalid
+	}
+
+	used, err := s.links.use(token, userID)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	if !used {
+		return ErrVerificationTokenInvalid
+	}
+
+	verified, err := s.rep.VerifyEmail(userID, values["email"])
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	if !verified {
+		return ErrVerificationTokenInvalid
+	}
+
+	s.logger.Infof("email address of user %d verified", userID)
+
+	return nil
+}
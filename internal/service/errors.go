@@ -0,0 +1,46 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Domain errors the handler maps onto replies. The more specific errors wrap
+// one of these, so errors.Is works on both levels.
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrConflict           = errors.New("conflict")
+	ErrUnauthorized       = errors.New("unauthorized")
+)
+
+var (
+	ErrUserExists  = fmt.Errorf("%w: such user exists", ErrConflict)
+	ErrEmailExists = fmt.Errorf("%w: email address in use", ErrConflict)
+
+	ErrTokenInvalid = fmt.Errorf("%w: invalid token", ErrUnauthorized)
+	// ErrTokenExpired is an ErrTokenInvalid as well
+	ErrTokenExpired = fmt.Errorf("%w: token expired", ErrTokenInvalid)
+	ErrTokenRevoked = fmt.Errorf("%w: token revoked", ErrUnauthorized)
+
+	ErrUnknownClient   = fmt.Errorf("%w: unknown client", ErrUnauthorized)
+	ErrAccountLocked   = fmt.Errorf("%w: too many failed sign-ins", ErrUnauthorized)
+	ErrSessionNotFound = fmt.Errorf("%w: session not found", ErrNotFound)
+	ErrProfileConflict = fmt.Errorf("%w: profile changed in the meantime", ErrConflict)
+	// ErrPasswordConflict means the password was changed by another request
+	ErrPasswordConflict  = fmt.Errorf("%w: password changed in the meantime", ErrConflict)
+	ErrResetTokenInvalid = fmt.Errorf("%w: invalid or expired reset token", ErrUnauthorized)
+
+	ErrEmailNotVerified         = fmt.Errorf("%w: email address not verified", ErrUnauthorized)
+	ErrVerificationTokenInvalid = fmt.Errorf("%w: invalid or expired verification token", ErrUnauthorized)
+
+	ErrMFAAlreadyEnabled   = fmt.Errorf("%w: mfa already enabled", ErrConflict)
+	ErrMFANotEnabled       = fmt.Errorf("%w: mfa not enabled", ErrNotFound)
+	ErrMFACodeInvalid      = fmt.Errorf("%w: invalid mfa code", ErrUnauthorized)
+	ErrMFAChallengeInvalid = fmt.Errorf("%w: invalid or expired mfa challenge", ErrUnauthorized)
+	// ErrMFAUnavailable means no encryption key is configured
+	ErrMFAUnavailable = errors.New("mfa is not available")
+	// ErrMFAEnrolmentConflict means the enrolment was confirmed or restarted by
+	// another request
+	ErrMFAEnrolmentConflict = fmt.Errorf("%w: mfa enrolment changed in the meantime", ErrConflict)
+)
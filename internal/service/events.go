@@ -0,0 +1,40 @@
+package service
+
+import (
+	"encoding/json"
+	"time"
+	"user/internal/model"
+)
+
+const SubjectTokensRevoked = "user.tokens.revoked"
+
+// Publisher is the part of *nats.Conn the services need to emit events
+type Publisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// publishRevoked lets consumers that verify tokens offline drop them before
+// they expire. Failing to publish does not fail the revocation itself.
+func (s *TokenService) publishRevoked(userID int, uuids []string) {
+
+	if len(uuids) == 0 {
+		return
+	}
+
+	event := model.RevocationEvent{
+		UserID:    userID,
+		Uuids:     uuids,
+		RevokedAt: time.Now().UTC(),
+	}
+
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		s.logger.Error(err)
+		return
+	}
+
+	err = s.publisher.Publish(SubjectTokensRevoked, eventBytes)
+	if err != nil {
+		s.logger.Error(err)
+	}
+}
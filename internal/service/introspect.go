@@ -0,0 +1,83 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"user/internal/model"
+)
+
+const (
+	TokenTypeAccess  = "access_token"
+	TokenTypeRefresh = "refresh_token"
+)
+
+// IntrospectToken describes a token the way RFC 7662 does. An invalid, expired
+// or revoked token is reported as inactive, an error means the store failed.
+func (s *TokenService) IntrospectToken(token, tokenTypeHint string) (*model.Introspection, error) {
+
+	if tokenTypeHint == TokenTypeRefresh {
+		return s.introspectRefreshToken(token)
+	}
+
+	accessDetails, err := s.VerifyAccessToken(token)
+	if errors.Is(err, ErrTokenInvalid) && tokenTypeHint == "" {
+		// without a hint the token may as well be a refresh token
+		return s.introspectRefreshToken(token)
+	}
+	if errors.Is(err, ErrTokenInvalid) || errors.Is(err, ErrTokenRevoked) {
+		return &model.Introspection{Active: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Introspection{
+		Active:    true,
+		Scope:     accessDetails.Scope,
+		TokenType: TokenTypeAccess,
+		ClientID:  accessDetails.ClientID,
+		Sub:       strconv.Itoa(accessDetails.UserId),
+		UserID:    accessDetails.UserId,
+		Iss:       accessDetails.Issuer,
+		Aud:       accessDetails.Audience,
+		Exp:       accessDetails.ExpiresAt,
+		Iat:       accessDetails.IssuedAt,
+		Nbf:       accessDetails.NotBefore,
+		AuthTime:  accessDetails.AuthTime,
+		Jti:       accessDetails.AccessUuid,
+		SessionID: accessDetails.SessionID,
+	}, nil
+}
+
+func (s *TokenService) introspectRefreshToken(token string) (*model.Introspection, error) {
+
+	refreshDetails, err := s.VerifyRefreshToken(token)
+	if errors.Is(err, ErrTokenInvalid) {
+		return &model.Introspection{Active: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := s.redis.Exists(refreshDetails.RefreshUuid).Result()
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+	if exists == 0 {
+		return &model.Introspection{Active: false}, nil
+	}
+
+	return &model.Introspection{
+		Active:    true,
+		TokenType: TokenTypeRefresh,
+		ClientID:  refreshDetails.ClientID,
+		Sub:       strconv.Itoa(refreshDetails.UserId),
+		UserID:    refreshDetails.UserId,
+		Exp:       refreshDetails.ExpiresAt,
+		Iat:       refreshDetails.IssuedAt,
+		AuthTime:  refreshDetails.AuthTime,
+		Jti:       refreshDetails.RefreshUuid,
+		SessionID: refreshDetails.FamilyID,
+	}, nil
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"time"
+	"user/config"
+)
+
+// lifetimePolicy decides how long the tokens of a session live. With an idle
+// timeout the session slides: every refresh pushes the refresh token expiry
+// idleTimeout ahead, but never past authTime+maxSessionAge.
+type lifetimePolicy struct {
+	accessTTL     time.Duration
+	refreshTTL    time.Duration
+	maxSessionAge time.Duration
+	idleTimeout   time.Duration
+}
+
+func newLifetimePolicy(cfg config.TokenCfg) lifetimePolicy {
+	return lifetimePolicy{
+		accessTTL:     cfg.AccessTTL,
+		refreshTTL:    cfg.RefreshTTL,
+		maxSessionAge: cfg.MaxSessionAge,
+		idleTimeout:   cfg.IdleTimeout,
+	}
+}
+
+// policyFor overrides the defaults with whatever the client configures
+func (s *TokenService) policyFor(clientID string) lifetimePolicy {
+
+	policy := s.defaultPolicy
+
+	client, ok := s.clients[clientID]
+	if !ok {
+		return policy
+	}
+
+	if client.AccessTTL > 0 {
+		policy.accessTTL = client.AccessTTL
+	}
+	if client.RefreshTTL > 0 {
+		policy.refreshTTL = client.RefreshTTL
+	}
+	if client.MaxSessionAge > 0 {
+		policy.maxSessionAge = client.MaxSessionAge
+	}
+	if client.IdleTimeout > 0 {
+		policy.idleTimeout = client.IdleTimeout
+	}
+
+	return policy
+}
+
+func (p lifetimePolicy) expiries(now, authTime time.Time) (int64, int64) {
+
+	sessionEnd := authTime.Add(p.maxSessionAge)
+
+	refreshExpires := now.Add(p.refreshTTL)
+	if p.idleTimeout > 0 {
+		refreshExpires = now.Add(p.idleTimeout)
+	}
+	if refreshExpires.After(sessionEnd) {
+		refreshExpires = sessionEnd
+	}
+
+	accessExpires := now.Add(p.accessTTL)
+	if accessExpires.After(refreshExpires) {
+		accessExpires = refreshExpires
+	}
+
+	return accessExpires.Unix(), refreshExpires.Unix()
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"testing"
+	"time"
+	"user/config"
+)
+
+func TestExpiries(t *testing.T) {
+
+	authTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	policy := lifetimePolicy{
+		accessTTL:     15 * time.Minute,
+		refreshTTL:    24 * time.Hour,
+		maxSessionAge: 72 * time.Hour,
+	}
+
+	sliding := policy
+	sliding.idleTimeout = 2 * time.Hour
+
+	tests := []struct {
+		name        string
+		policy      lifetimePolicy
+		now         time.Time
+		wantAccess  time.Time
+		wantRefresh time.Time
+	}{
+		{
+			name:        "fresh sign-in",
+			policy:      policy,
+			now:         authTime,
+			wantAccess:  authTime.Add(15 * time.Minute),
+			wantRefresh: authTime.Add(24 * time.Hour),
+		},
+		{
+			name:        "refresh is capped by the session age",
+			policy:      policy,
+			now:         authTime.Add(60 * time.Hour),
+			wantAccess:  authTime.Add(60*time.Hour + 15*time.Minute),
+			wantRefresh: authTime.Add(72 * time.Hour),
+		},
+		{
+			name:        "access is capped by the refresh expiry",
+			policy:      policy,
+			now:         authTime.Add(72*time.Hour - 5*time.Minute),
+			wantAccess:  authTime.Add(72 * time.Hour),
+			wantRefresh: authTime.Add(72 * time.Hour),
+		},
+		{
+			name:        "idle timeout replaces the refresh lifetime",
+			policy:      sliding,
+			now:         authTime.Add(time.Hour),
+			wantAccess:  authTime.Add(time.Hour + 15*time.Minute),
+			wantRefresh: authTime.Add(3 * time.Hour),
+		},
+		{
+			name:        "sliding session still ends at the session age",
+			policy:      sliding,
+			now:         authTime.Add(71 * time.Hour),
+			wantAccess:  authTime.Add(71*time.Hour + 15*time.Minute),
+			wantRefresh: authTime.Add(72 * time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			access, refresh := tt.policy.expiries(tt.now, authTime)
+			if access != tt.wantAccess.Unix() {
+				t.Errorf("access expires %v, want %v", time.Unix(access, 0).UTC(), tt.wantAccess)
+			}
+			if refresh != tt.wantRefresh.Unix() {
+				t.Errorf("refresh expires %v, want %v", time.Unix(refresh, 0).UTC(), tt.wantRefresh)
+			}
+		})
+	}
+}
+
+func TestPolicyFor(t *testing.T) {
+
+	s := NewTokenService(nil, nil, nil, nil, config.TokenCfg{
+		AccessTTL:     15 * time.Minute,
+		RefreshTTL:    24 * time.Hour,
+		MaxSessionAge: 72 * time.Hour,
+		Clients: map[string]config.ClientCfg{
+			"mobile": {RefreshTTL: 720 * time.Hour, MaxSessionAge: 2160 * time.Hour},
+			"kiosk":  {AccessTTL: 5 * time.Minute, IdleTimeout: 10 * time.Minute},
+		},
+	}, nil)
+
+	tests := []struct {
+		clientID string
+		want     lifetimePolicy
+	}{
+		{"", lifetimePolicy{15 * time.Minute, 24 * time.Hour, 72 * time.Hour, 0}},
+		{"unknown", lifetimePolicy{15 * time.Minute, 24 * time.Hour, 72 * time.Hour, 0}},
+		{"mobile", lifetimePolicy{15 * time.Minute, 720 * time.Hour, 2160 * time.Hour, 0}},
+		{"kiosk", lifetimePolicy{5 * time.Minute, 24 * time.Hour, 72 * time.Hour, 10 * time.Minute}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.clientID, func(t *testing.T) {
+			if got := s.policyFor(tt.clientID); got != tt.want {
+				t.Errorf("policyFor(%q) = %+v, want %+v", tt.clientID, got, tt.want)
+			}
+		})
+	}
+
+	// the session indexes must outlive the longest session of any client
+	if s.maxSessionAge != 2160*time.Hour {
+		t.Errorf("maxSessionAge = %v", s.maxSessionAge)
+	}
+}
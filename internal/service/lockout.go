@@ -0,0 +1,314 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis"
+	"strconv"
+	"strings"
+	"time"
+	"user/config"
+	"user/internal/logging"
+	"user/internal/model"
+	"user/internal/repository"
+)
+
+const (
+	SubjectAccountLocked   = "user.account.locked"
+	SubjectAccountUnlocked = "user.account.unlocked"
+)
+
+// LockedError is an ErrAccountLocked telling when to try again. Locked is
+// false while the caller only has to back off.
+type LockedError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrAccountLocked, e.RetryAfter)
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrAccountLocked
+}
+
+// a failure counter, either of an account or of a client IP
+type lockoutTarget struct {
+	key         string
+	name        string
+	userID      int
+	source      string
+	maxFailures int
+}
+
+type LockoutService struct {
+	logger    *logging.Logger
+	redis     *redis.Client
+	users     *UserService
+	cfg       config.LockoutCfg
+	publisher Publisher
+}
+
+func NewLockoutService(log *logging.Logger, redis *redis.Client, users *UserService, cfg config.LockoutCfg, publisher Publisher) *LockoutService {
+	return &LockoutService{
+		logger:    log,
+		redis:     redis,
+		users:     users,
+		cfg:       cfg,
+		publisher: publisher,
+	}
+}
+
+// normalizeLoginName gives one spelling of an address in any letter case,
+// usernames are compared as they are
+func normalizeLoginName(name string) string {
+	if strings.Contains(name, "@") {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+func (s *LockoutService) targets(name, source string) ([]lockoutTarget, error) {
+
+	var targets []lockoutTarget
+
+	if name != "" {
+		target, err := s.accountTarget(name)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+
+	// the IP comes from the gateway, internal callers may not send one
+	if source != "" {
+		targets = append(targets, lockoutTarget{
+			key:         "login_failures:source:" + source,
+			source:      source,
+			maxFailures: s.cfg.SourceMaxFailures,
+		})
+	}
+
+	return targets, nil
+}
+
+// accountTarget counts the failures of a user on their ID, so the username
+// and the address share one counter. A name of no active user gets its own.
+func (s *LockoutService) accountTarget(name string) (lockoutTarget, error) {
+
+	name = normalizeLoginName(name)
+
+	target := lockoutTarget{
+		key:         "login_failures:name:" + name,
+		name:        name,
+		maxFailures: s.cfg.MaxFailures,
+	}
+
+	user, err := s.users.findUser(name)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return target, nil
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return lockoutTarget{}, err
+	}
+
+	target.key = "login_failures:account:" + strconv.Itoa(user.ID)
+	target.userID = user.ID
+
+	return target, nil
+}
+
+// CheckLogin returns a *LockedError while the account or the IP is locked or
+// has to back off. It runs before the password is checked, name is a username
+// or an email address.
+func (s *LockoutService) CheckLogin(name, source string) error {
+
+	now := time.Now()
+
+	targets, err := s.targets(name, source)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+
+		values, err := s.redis.HGetAll(target.key).Result()
+		if err != nil {
+			s.logger.Error(err)
+			return err
+		}
+
+		lockedUntil := millisField(values["locked_until"])
+		if !lockedUntil.IsZero() {
+			if now.Before(lockedUntil) {
+				return &LockedError{RetryAfter: lockedUntil.Sub(now), Locked: true}
+			}
+
+			// the lock is served, the next attempts start from scratch
+			err = s.redis.Del(target.key).Err()
+			if err != nil {
+				s.logger.Error(err)
+				return err
+			}
+			s.publish(SubjectAccountUnlocked, target, 0, nil, "expired")
+			continue
+		}
+
+		failures, _ := strconv.Atoi(values["failures"])
+		wait := millisField(values["last_failure"]).Add(s.backoff(failures)).Sub(now)
+		if wait > 0 {
+			return &LockedError{RetryAfter: wait}
+		}
+	}
+
+	return nil
+}
+
+// backoff is how long to wait after the given number of failures
+func (s *LockoutService) backoff(failures int) time.Duration {
+
+	if s.cfg.BackoffAfter <= 0 || failures < s.cfg.BackoffAfter {
+		return 0
+	}
+
+	delay := s.cfg.BackoffBase
+	for i := s.cfg.BackoffAfter; i < failures && delay < s.cfg.BackoffMax; i++ {
+		delay *= 2
+	}
+
+	if delay > s.cfg.BackoffMax {
+		return s.cfg.BackoffMax
+	}
+
+	return delay
+}
+
+// RecordLoginFailure counts a failed sign-in and locks the account or the IP
+// once it reaches its limit.
+func (s *LockoutService) RecordLoginFailure(name, source string) error {
+
+	now := time.Now()
+
+	targets, err := s.targets(name, source)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+
+		var failures *redis.IntCmd
+
+		_, err := s.redis.TxPipelined(func(pipe redis.Pipeliner) error {
+			failures = pipe.HIncrBy(target.key, "failures", 1)
+			pipe.HSet(target.key, "last_failure", now.UnixMilli())
+			pipe.Expire(target.key, s.cfg.FailureWindow+s.cfg.LockoutDuration)
+			return nil
+		})
+		if err != nil {
+			s.logger.Error(err)
+			return err
+		}
+
+		if target.maxFailures <= 0 || failures.Val() < int64(target.maxFailures) {
+			continue
+		}
+
+		lockedUntil := now.Add(s.cfg.LockoutDuration)
+
+		// concurrent failures lock only once
+		locked, err := s.redis.HSetNX(target.key, "locked_until", lockedUntil.UnixMilli()).Result()
+		if err != nil {
+			s.logger.Error(err)
+			return err
+		}
+
+		if locked {
+			s.logger.Warnf("sign-in locked until %s after %d failures", lockedUntil.UTC().Format(time.RFC3339), failures.Val())
+			s.publish(SubjectAccountLocked, target, int(failures.Val()), &lockedUntil, "")
+		}
+	}
+
+	return nil
+}
+
+// RecordLoginSuccess forgets the failures of the account, those of the IP
+// stay as one IP may guess for many users.
+func (s *LockoutService) RecordLoginSuccess(name string) error {
+
+	target, err := s.accountTarget(name)
+	if err != nil {
+		return err
+	}
+
+	err = s.redis.Del(target.key).Err()
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// ClearLockout drops the lock and the failures of an account and/or an IP.
+func (s *LockoutService) ClearLockout(name, source string) error {
+
+	targets, err := s.targets(name, source)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+
+		deleted, err := s.redis.Del(target.key).Result()
+		if err != nil {
+			s.logger.Error(err)
+			return err
+		}
+
+		if deleted > 0 {
+			s.publish(SubjectAccountUnlocked, target, 0, nil, "admin")
+		}
+	}
+
+	return nil
+}
+
+func (s *LockoutService) publish(subject string, target lockoutTarget, failures int, lockedUntil *time.Time, reason string) {
+
+	event := model.LockoutEvent{
+		Name:     target.name,
+		UserID:   target.userID,
+		Source:   target.source,
+		Failures: failures,
+		Reason:   reason,
+		At:       time.Now().UTC(),
+	}
+
+	if lockedUntil != nil {
+		utc := lockedUntil.UTC()
+		event.LockedUntil = &utc
+	}
+
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		s.logger.Error(err)
+		return
+	}
+
+	err = s.publisher.Publish(subject, eventBytes)
+	if err != nil {
+		s.logger.Error(err)
+	}
+}
+
+func millisField(value string) time.Time {
+	millis, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.UnixMilli(millis)
+}
@@ -0,0 +1,271 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"user/config"
+	"user/internal/logging"
+	"user/internal/model"
+	"user/internal/repository"
+)
+
+// testUsers is a User repository of fixed active users, the methods a test
+// doesn't override panic
+type testUsers struct {
+	repository.User
+	users []*model.User
+}
+
+func (r *testUsers) GetUser(u *model.User) (*model.User, error) {
+	for _, user := range r.users {
+		if user.Name == u.Name {
+			return user, nil
+		}
+	}
+	return nil, repository.ErrUserNotFound
+}
+
+func (r *testUsers) GetUserByEmail(email string) (*model.User, error) {
+	for _, user := range r.users {
+		if user.Email != "" && strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return nil, repository.ErrUserNotFound
+}
+
+func (r *testUsers) GetUserByID(userID int) (*model.User, error) {
+	for _, user := range r.users {
+		if user.ID == userID {
+			return user, nil
+		}
+	}
+	return nil, repository.ErrUserNotFound
+}
+
+var testLockoutCfg = config.LockoutCfg{
+	MaxFailures:       3,
+	SourceMaxFailures: 5,
+	LockoutDuration:   15 * time.Minute,
+	FailureWindow:     15 * time.Minute,
+}
+
+func newTestLockoutService(t *testing.T, cfg config.LockoutCfg) (*LockoutService, *testPublisher) {
+	t.Helper()
+
+	client, _ := newTestRedis(t)
+
+	rep := &repository.Repository{User: &testUsers{users: []*model.User{
+		{ID: 1, Name: "alice", Email: "alice@example.com"},
+		{ID: 2, Name: "bob"},
+	}}}
+
+	log := logging.GetLogger()
+	publisher := &testPublisher{}
+
+	users := NewUserService(rep, log, nil, nil, nil, publisher, config.EmailCfg{})
+
+	return NewLockoutService(log, client, users, cfg, publisher), publisher
+}
+
+func recordFailures(t *testing.T, s *LockoutService, source string, names ...string) {
+	t.Helper()
+
+	for _, name := range names {
+		err := s.RecordLoginFailure(name, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func checkLocked(t *testing.T, s *LockoutService, name, source string, want bool) {
+	t.Helper()
+
+	err := s.CheckLogin(name, source)
+
+	var lockedErr *LockedError
+	locked := errors.As(err, &lockedErr) && lockedErr.Locked
+	if err != nil && !locked {
+		t.Fatalf("CheckLogin(%q, %q) error = %v", name, source, err)
+	}
+	if locked != want {
+		t.Errorf("CheckLogin(%q, %q) locked = %v, want %v", name, source, locked, want)
+	}
+}
+
+func TestLockoutThreshold(t *testing.T) {
+
+	s, publisher := newTestLockoutService(t, testLockoutCfg)
+
+	recordFailures(t, s, "", "alice", "alice")
+	checkLocked(t, s, "alice", "", false)
+
+	recordFailures(t, s, "", "alice")
+	checkLocked(t, s, "alice", "", true)
+
+	err := s.CheckLogin("alice", "")
+	if !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("CheckLogin() error = %v, want %v", err, ErrAccountLocked)
+	}
+
+	// other accounts are not affected
+	checkLocked(t, s, "bob", "", false)
+
+	if got := publisher.count(SubjectAccountLocked); got != 1 {
+		t.Errorf("%d %s events, want 1", got, SubjectAccountLocked)
+	}
+}
+
+func TestLockoutCountsAccount(t *testing.T) {
+
+	s, _ := newTestLockoutService(t, testLockoutCfg)
+
+	// the username and the address in any letter case share one counter
+	recordFailures(t, s, "", "alice", "Alice@Example.com", "alice@example.com")
+
+	for _, name := range []string{"alice", "alice@example.com", "ALICE@EXAMPLE.COM"} {
+		checkLocked(t, s, name, "", true)
+	}
+}
+
+func TestLockoutUnknownName(t *testing.T) {
+
+	s, _ := newTestLockoutService(t, testLockoutCfg)
+
+	recordFailures(t, s, "", "mallory@example.com", "Mallory@example.com", "MALLORY@example.com")
+
+	checkLocked(t, s, "mallory@example.com", "", true)
+	checkLocked(t, s, "alice@example.com", "", false)
+}
+
+func TestLockoutSuccessResets(t *testing.T) {
+
+	s, _ := newTestLockoutService(t, testLockoutCfg)
+
+	recordFailures(t, s, "", "alice", "alice")
+
+	err := s.RecordLoginSuccess("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recordFailures(t, s, "", "alice", "alice")
+	checkLocked(t, s, "alice", "", false)
+}
+
+func TestLockoutExpires(t *testing.T) {
+
+	s, publisher := newTestLockoutService(t, testLockoutCfg)
+
+	recordFailures(t, s, "", "bob", "bob", "bob")
+	checkLocked(t, s, "bob", "", true)
+
+	// serve the lock
+	err := s.redis.HSet("login_failures:account:2", "locked_until", time.Now().Add(-time.Second).UnixMilli()).Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkLocked(t, s, "bob", "", false)
+
+	// the counter starts from scratch
+	recordFailures(t, s, "", "bob", "bob")
+	checkLocked(t, s, "bob", "", false)
+
+	if got := publisher.count(SubjectAccountUnlocked); got != 1 {
+		t.Errorf("%d %s events, want 1", got, SubjectAccountUnlocked)
+	}
+}
+
+func TestLockoutSource(t *testing.T) {
+
+	s, _ := newTestLockoutService(t, testLockoutCfg)
+
+	recordFailures(t, s, "192.0.2.1", "alice", "bob", "carol", "dave", "erin")
+
+	// the IP is locked for every name, another IP is not
+	checkLocked(t, s, "frank", "192.0.2.1", true)
+	checkLocked(t, s, "frank", "192.0.2.2", false)
+
+	err := s.RecordLoginSuccess("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkLocked(t, s, "alice", "192.0.2.1", true)
+}
+
+func TestClearLockout(t *testing.T) {
+
+	s, publisher := newTestLockoutService(t, testLockoutCfg)
+
+	recordFailures(t, s, "192.0.2.1", "alice", "alice", "alice", "alice", "alice")
+	checkLocked(t, s, "alice", "", true)
+	checkLocked(t, s, "bob", "192.0.2.1", true)
+
+	err := s.ClearLockout("Alice@Example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkLocked(t, s, "alice", "", false)
+	checkLocked(t, s, "alice", "192.0.2.1", true)
+
+	err = s.ClearLockout("", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkLocked(t, s, "alice", "192.0.2.1", false)
+
+	if got := publisher.count(SubjectAccountUnlocked); got != 2 {
+		t.Errorf("%d %s events, want 2", got, SubjectAccountUnlocked)
+	}
+}
+
+func TestLockoutBackoff(t *testing.T) {
+
+	s := &LockoutService{cfg: config.LockoutCfg{
+		BackoffAfter: 2,
+		BackoffBase:  time.Second,
+		BackoffMax:   5 * time.Second,
+	}}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, 0},
+		{2, time.Second},
+		{3, 2 * time.Second},
+		{4, 4 * time.Second},
+		{5, 5 * time.Second},
+		{50, 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := s.backoff(tt.failures); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+
+	recorded, _ := newTestLockoutService(t, config.LockoutCfg{
+		MaxFailures:   10,
+		BackoffAfter:  2,
+		BackoffBase:   time.Minute,
+		BackoffMax:    time.Hour,
+		FailureWindow: time.Hour,
+	})
+
+	recordFailures(t, recorded, "", "alice", "alice")
+
+	err := recorded.CheckLogin("alice", "")
+	var lockedErr *LockedError
+	if !errors.As(err, &lockedErr) || lockedErr.Locked || lockedErr.RetryAfter <= 0 {
+		t.Errorf("CheckLogin() error = %v, want a back-off", err)
+	}
+}
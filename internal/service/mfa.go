@@ -0,0 +1,534 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/go-redis/redis"
+	"strconv"
+	"time"
+	"user/config"
+	"user/internal/logging"
+	"user/internal/mfa"
+	"user/internal/model"
+	"user/internal/repository"
+)
+
+const SubjectRecoveryCodeUsed = "user.mfa.recovery-code-used"
+
+func mfaChallengeKey(challengeToken string) string {
+	return "mfa_challenge:" + challengeToken
+}
+
+// an attempt on a challenge holds the claimed field until it fails or the
+// challenge is used up, so one challenge never burns two recovery codes. A
+// missing key is not recreated.
+var claimChallenge = redis.NewScript(`
+local key = KEYS[1]
+
+if redis.call('EXISTS', key) == 0 then
+	return false
+end
+
+if redis.call('HSETNX', key, 'claimed', 1) == 0 then
+	return false
+end
+
+redis.call('HINCRBY', key, 'attempts', 1)
+
+return redis.call('HGETALL', key)
+`)
+
+type MFAService struct {
+	rep       *repository.Repository
+	logger    *logging.Logger
+	redis     *redis.Client
+	cipher    *mfa.Cipher
+	cfg       config.MFACfg
+	publisher Publisher
+	lockout   Lockout
+}
+
+// NewMFAService takes a nil cipher when no encryption key is configured, every
+// MFA call fails with ErrMFAUnavailable then, sign-in of enrolled users too.
+// Wrong codes on sign-in count as failed sign-ins in lockout.
+func NewMFAService(rep *repository.Repository, log *logging.Logger, redis *redis.Client, cipher *mfa.Cipher, cfg config.MFACfg, publisher Publisher, lockout Lockout) *MFAService {
+	return &MFAService{
+		rep:       rep,
+		logger:    log,
+		redis:     redis,
+		cipher:    cipher,
+		cfg:       cfg,
+		publisher: publisher,
+		lockout:   lockout,
+	}
+}
+
+// MFAEnabled fails closed: without an encryption key the codes of an enabled
+// enrolment can't be checked, and a password alone must not be enough.
+func (s *MFAService) MFAEnabled(userID int) (bool, error) {
+
+	enabled, err := s.enrolled(userID)
+	if err != nil {
+		return false, err
+	}
+
+	if enabled && s.cipher == nil {
+		s.logger.Errorf("user %d has mfa enabled but no encryption key is configured", userID)
+		return false, ErrMFAUnavailable
+	}
+
+	return enabled, nil
+}
+
+// enrolled reports whether the user has confirmed an enrolment
+func (s *MFAService) enrolled(userID int) (bool, error) {
+
+	enrolment, err := s.rep.GetMFA(userID)
+	if errors.Is(err, repository.ErrMFANotFound) {
+		return false, nil
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return false, err
+	}
+
+	return enrolment.Enabled, nil
+}
+
+// EnrollMFA creates a new secret. MFA stays off until ConfirmMFA proves the
+// user has set up their authenticator app.
+func (s *MFAService) EnrollMFA(userID int) (*model.MFAEnrollment, error) {
+
+	if s.cipher == nil {
+		return nil, ErrMFAUnavailable
+	}
+
+	user, err := s.rep.GetUserByID(userID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil, ErrTokenRevoked
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+
+	secret, err := mfa.GenerateSecret()
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+
+	sealed, err := s.cipher.Seal(secret, userID)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+
+	saved, err := s.rep.SaveMFASecret(userID, sealed)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+	if !saved {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	return &model.MFAEnrollment{
+		Secret: mfa.EncodeSecret(secret),
+		URI:    mfa.URI(s.cfg.Issuer, user.Name, secret),
+	}, nil
+}
+
+// ConfirmMFA enables MFA and hands out the recovery codes.
+func (s *MFAService) ConfirmMFA(userID int, code string) (*model.RecoveryCodes, error) {
+
+	enrolment, step, err := s.verifyCode(userID, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if enrolment.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	// only the request that enables the enrolment stores recovery codes, a
+	// concurrent confirm must not replace the ones already handed out
+	enabled, err := s.rep.EnableMFA(userID, enrolment.Secret, step)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+	if !enabled {
+		return nil, ErrMFAEnrolmentConflict
+	}
+
+	s.logger.Infof("mfa enabled for user %d", userID)
+
+	codes, err := s.generateRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes replaces every code, used or not. Like disabling it
+// needs a current TOTP code.
+func (s *MFAService) RegenerateRecoveryCodes(userID int, code string) (*model.RecoveryCodes, error) {
+
+	enrolment, _, err := s.verifyCode(userID, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if !enrolment.Enabled {
+		return nil, ErrMFANotEnabled
+	}
+
+	codes, err := s.generateRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Infof("recovery codes of user %d regenerated", userID)
+
+	return codes, nil
+}
+
+func (s *MFAService) generateRecoveryCodes(userID int) (*model.RecoveryCodes, error) {
+
+	codes, err := mfa.GenerateRecoveryCodes(s.cfg.RecoveryCodes)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, s.cipher.MAC([]byte(mfa.NormalizeRecoveryCode(code)), userID))
+	}
+
+	err = s.rep.ReplaceRecoveryCodes(userID, hashes)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+
+	return &model.RecoveryCodes{RecoveryCodes: codes}, nil
+}
+
+func (s *MFAService) MFAStatus(userID int) (*model.MFAStatus, error) {
+
+	enabled, err := s.enrolled(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return &model.MFAStatus{}, nil
+	}
+
+	remaining, err := s.rep.CountRecoveryCodes(userID)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+
+	return &model.MFAStatus{
+		Enabled:                true,
+		RecoveryCodesRemaining: remaining,
+	}, nil
+}
+
+// useRecoveryCode burns a recovery code in place of a TOTP code
+func (s *MFAService) useRecoveryCode(userID int, recoveryCode string, client *model.ClientInfo) error {
+
+	enabled, err := s.MFAEnabled(userID)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrMFAChallengeInvalid
+	}
+
+	used, err := s.rep.UseRecoveryCode(userID, s.cipher.MAC([]byte(mfa.NormalizeRecoveryCode(recoveryCode)), userID))
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	if !used {
+		return ErrMFACodeInvalid
+	}
+
+	remaining, err := s.rep.CountRecoveryCodes(userID)
+	if err != nil {
+		s.logger.Error(err)
+	}
+
+	s.logger.Warnf("user %d signed in with a recovery code, %d left", userID, remaining)
+
+	s.publishRecoveryCodeUsed(model.RecoveryCodeUsedEvent{
+		UserID:    userID,
+		Remaining: remaining,
+		ClientIP:  client.ClientIP,
+		UserAgent: client.UserAgent,
+		UsedAt:    time.Now().UTC(),
+	})
+
+	return nil
+}
+
+// publishRecoveryCodeUsed feeds the audit trail, a recovery code in use may
+// mean a lost or a stolen device.
+func (s *MFAService) publishRecoveryCodeUsed(event model.RecoveryCodeUsedEvent) {
+
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		s.logger.Error(err)
+		return
+	}
+
+	err = s.publisher.Publish(SubjectRecoveryCodeUsed, eventBytes)
+	if err != nil {
+		s.logger.Error(err)
+	}
+}
+
+// DisableMFA needs a current code, a stolen access token alone can't turn MFA
+// off.
+func (s *MFAService) DisableMFA(userID int, code string) error {
+
+	enrolment, _, err := s.verifyCode(userID, code)
+	if err != nil {
+		return err
+	}
+
+	if !enrolment.Enabled {
+		return ErrMFANotEnabled
+	}
+
+	err = s.rep.DeleteMFA(userID)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	s.logger.Infof("mfa disabled for user %d", userID)
+
+	return nil
+}
+
+// verifyCode checks the code against the enrolment of the user and burns its
+// step.
+func (s *MFAService) verifyCode(userID int, code string) (*model.MFA, int64, error) {
+
+	if s.cipher == nil {
+		return nil, 0, ErrMFAUnavailable
+	}
+
+	enrolment, err := s.rep.GetMFA(userID)
+	if errors.Is(err, repository.ErrMFANotFound) {
+		return nil, 0, ErrMFANotEnabled
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return nil, 0, err
+	}
+
+	secret, err := s.cipher.Open(enrolment.Secret, userID)
+	if err != nil {
+		s.logger.Errorf("cannot decrypt mfa secret of user %d: %v", userID, err)
+		return nil, 0, err
+	}
+
+	step, ok := mfa.Verify(secret, code, time.Now(), s.cfg.Skew)
+	if !ok || step <= enrolment.LastUsedStep {
+		return nil, 0, ErrMFACodeInvalid
+	}
+
+	// a pending enrolment records the step when it is enabled
+	if enrolment.Enabled {
+		used, err := s.rep.UseMFAStep(userID, step)
+		if err != nil {
+			s.logger.Error(err)
+			return nil, 0, err
+		}
+		if !used {
+			return nil, 0, ErrMFACodeInvalid
+		}
+	}
+
+	return enrolment, step, nil
+}
+
+// CreateMFAChallenge remembers a sign-in whose password was right until the
+// code arrives. The challenge token is the only proof of the password step,
+// name is what the user signed in with and keys the lockout.
+func (s *MFAService) CreateMFAChallenge(userID int, name string, client *model.ClientInfo) (*model.MFAChallenge, error) {
+
+	tokenBytes := make([]byte, 32)
+
+	_, err := rand.Read(tokenBytes)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+
+	challengeToken := base64.RawURLEncoding.EncodeToString(tokenBytes)
+	key := mfaChallengeKey(challengeToken)
+
+	_, err = s.redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HMSet(key, map[string]interface{}{
+			"user_id":     userID,
+			"name":        name,
+			"client_id":   client.ClientID,
+			"client_ip":   client.ClientIP,
+			"user_agent":  client.UserAgent,
+			"device_name": client.DeviceName,
+			"attempts":    0,
+		})
+		pipe.Expire(key, s.cfg.ChallengeTTL)
+		return nil
+	})
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+
+	return &model.MFAChallenge{
+		MFARequired:    true,
+		ChallengeToken: challengeToken,
+		ExpiresIn:      int(s.cfg.ChallengeTTL.Seconds()),
+	}, nil
+}
+
+// VerifyMFAChallenge completes a sign-in with a TOTP code or, when set, a
+// recovery code. After max_attempts wrong codes the challenge is dropped and
+// the password has to be entered again.
+func (s *MFAService) VerifyMFAChallenge(challengeToken, code, recoveryCode string) (int, *model.ClientInfo, error) {
+
+	key := mfaChallengeKey(challengeToken)
+
+	values, err := s.claimChallenge(key)
+	if err == redis.Nil {
+		return 0, nil, ErrMFAChallengeInvalid
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return 0, nil, err
+	}
+
+	userID, err := strconv.Atoi(values["user_id"])
+	if err != nil {
+		s.redis.Del(key)
+		return 0, nil, ErrMFAChallengeInvalid
+	}
+
+	attempts, _ := strconv.Atoi(values["attempts"])
+	if attempts > s.cfg.MaxAttempts {
+		s.redis.Del(key)
+		return 0, nil, ErrMFAChallengeInvalid
+	}
+
+	// the account may have been deleted since the password was checked
+	_, err = s.rep.GetUserByID(userID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		s.redis.Del(key)
+		return 0, nil, ErrMFAChallengeInvalid
+	}
+	if err != nil {
+		// let the next attempt in
+		s.redis.HDel(key, "claimed")
+		s.logger.Error(err)
+		return 0, nil, err
+	}
+
+	client := &model.ClientInfo{
+		ClientID:   values["client_id"],
+		ClientIP:   values["client_ip"],
+		UserAgent:  values["user_agent"],
+		DeviceName: values["device_name"],
+	}
+	name := values["name"]
+
+	err = s.verifyChallengeAttempt(userID, name, code, recoveryCode, client)
+	if err != nil {
+		// let the next attempt in, a challenge that expired meanwhile stays gone
+		s.redis.HDel(key, "claimed")
+		return 0, nil, err
+	}
+
+	err = s.redis.Del(key).Err()
+	if err != nil {
+		s.logger.Error(err)
+	}
+
+	err = s.lockout.RecordLoginSuccess(name)
+	if err != nil {
+		s.logger.Error(err)
+	}
+
+	return userID, client, nil
+}
+
+// claimChallenge counts an attempt and claims the challenge for it in one
+// step. It returns redis.Nil for a challenge that is gone or claimed by a
+// concurrent attempt.
+func (s *MFAService) claimChallenge(key string) (map[string]string, error) {
+
+	result, err := claimChallenge.Run(s.redis, []string{key}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	fields, _ := result.([]interface{})
+
+	values := make(map[string]string, len(fields)/2)
+	for i := 0; i+1 < len(fields); i += 2 {
+		field, _ := fields[i].(string)
+		value, _ := fields[i+1].(string)
+		values[field] = value
+	}
+
+	return values, nil
+}
+
+func (s *MFAService) verifyChallengeAttempt(userID int, name, code, recoveryCode string, client *model.ClientInfo) error {
+
+	// a lock taken while the challenge was open holds for codes as well
+	err := s.lockout.CheckLogin(name, client.ClientIP)
+	if err != nil {
+		return err
+	}
+
+	err = s.verifyChallengeCode(userID, code, recoveryCode, client)
+	if errors.Is(err, ErrMFACodeInvalid) {
+		// new challenges are cheap, so wrong codes count against the user
+		lockErr := s.lockout.RecordLoginFailure(name, client.ClientIP)
+		if lockErr != nil {
+			s.logger.Error(lockErr)
+		}
+	}
+
+	return err
+}
+
+func (s *MFAService) verifyChallengeCode(userID int, code, recoveryCode string, client *model.ClientInfo) error {
+
+	if recoveryCode != "" {
+		return s.useRecoveryCode(userID, recoveryCode, client)
+	}
+
+	enrolment, _, err := s.verifyCode(userID, code)
+	if err != nil {
+		return err
+	}
+
+	// MFA was turned off and a new enrolment started since the password step
+	if !enrolment.Enabled {
+		return ErrMFAChallengeInvalid
+	}
+
+	return nil
+}
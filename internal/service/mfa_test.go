@@ -0,0 +1,390 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"testing"
+	"time"
+	"user/config"
+	"user/internal/logging"
+	"user/internal/mfa"
+	"user/internal/model"
+	"user/internal/repository"
+)
+
+// testMFA keeps enrolments and recovery codes in memory, the updates check
+// the same conditions as the SQL ones
+type testMFA struct {
+	enrolments map[int]*model.MFA
+	codes      map[int]map[string]bool
+}
+
+func (r *testMFA) GetMFA(userID int) (*model.MFA, error) {
+	enrolment, ok := r.enrolments[userID]
+	if !ok {
+		return nil, repository.ErrMFANotFound
+	}
+	copied := *enrolment
+	return &copied, nil
+}
+
+func (r *testMFA) SaveMFASecret(userID int, secret []byte) (bool, error) {
+	enrolment, ok := r.enrolments[userID]
+	if ok && enrolment.Enabled {
+		return false, nil
+	}
+	r.enrolments[userID] = &model.MFA{UserID: userID, Secret: secret}
+	return true, nil
+}
+
+func (r *testMFA) EnableMFA(userID int, secret []byte, step int64) (bool, error) {
+	enrolment, ok := r.enrolments[userID]
+	if !ok || enrolment.Enabled || !bytes.Equal(enrolment.Secret, secret) {
+		return false, nil
+	}
+	enrolment.Enabled = true
+	enrolment.LastUsedStep = step
+	return true, nil
+}
+
+func (r *testMFA) UseMFAStep(userID int, step int64) (bool, error) {
+	enrolment, ok := r.enrolments[userID]
+	if !ok || enrolment.LastUsedStep >= step {
+		return false, nil
+	}
+	enrolment.LastUsedStep = step
+	return true, nil
+}
+
+func (r *testMFA) DeleteMFA(userID int) error {
+	delete(r.enrolments, userID)
+	delete(r.codes, userID)
+	return nil
+}
+
+func (r *testMFA) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	r.codes[userID] = make(map[string]bool, len(codeHashes))
+	for _, codeHash := range codeHashes {
+		r.codes[userID][codeHash] = false
+	}
+	return nil
+}
+
+func (r *testMFA) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	used, ok := r.codes[userID][codeHash]
+	if !ok || used {
+		return false, nil
+	}
+	r.codes[userID][codeHash] = true
+	return true, nil
+}
+
+func (r *testMFA) CountRecoveryCodes(userID int) (int, error) {
+	count := 0
+	for _, used := range r.codes[userID] {
+		if !used {
+			count++
+		}
+	}
+	return count, nil
+}
+
+var testMFACfg = config.MFACfg{
+	Issuer:        "user-service",
+	EncryptionKey: base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")),
+	Skew:          1,
+	ChallengeTTL:  5 * time.Minute,
+	MaxAttempts:   3,
+	RecoveryCodes: 4,
+}
+
+type testMFAEnv struct {
+	s         *MFAService
+	users     *testUsers
+	mfa       *testMFA
+	server    *miniredis.Miniredis
+	publisher *testPublisher
+	secret    []byte
+	recovery  []string
+}
+
+// newTestMFAService enrols alice with MFA enabled and a set of recovery codes
+func newTestMFAService(t *testing.T, lockoutCfg config.LockoutCfg) *testMFAEnv {
+	t.Helper()
+
+	client, server := newTestRedis(t)
+
+	cipher, err := mfa.LoadCipher(testMFACfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := &testMFAEnv{
+		users: &testUsers{users: []*model.User{
+			{ID: 1, Name: "alice", Email: "alice@example.com"},
+		}},
+		mfa: &testMFA{
+			enrolments: map[int]*model.MFA{},
+			codes:      map[int]map[string]bool{},
+		},
+		server:    server,
+		publisher: &testPublisher{},
+	}
+
+	rep := &repository.Repository{User: env.users, MFA: env.mfa}
+	log := logging.GetLogger()
+
+	lockout := NewLockoutService(log, client, NewUserService(rep, log, nil, nil, nil, env.publisher, config.EmailCfg{}), lockoutCfg, env.publisher)
+
+	env.s = NewMFAService(rep, log, client, cipher, testMFACfg, env.publisher, lockout)
+
+	env.secret, err = mfa.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := cipher.Seal(env.secret, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.mfa.enrolments[1] = &model.MFA{UserID: 1, Secret: sealed, Enabled: true}
+
+	env.recovery, err = mfa.GenerateRecoveryCodes(testMFACfg.RecoveryCodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashes := make([]string, 0, len(env.recovery))
+	for _, code := range env.recovery {
+		hashes = append(hashes, cipher.MAC([]byte(mfa.NormalizeRecoveryCode(code)), 1))
+	}
+	_ = env.mfa.ReplaceRecoveryCodes(1, hashes)
+
+	return env
+}
+
+func (env *testMFAEnv) code() string {
+	return mfa.Code(env.secret, mfa.Step(time.Now()))
+}
+
+// wrongCode is a code outside the accepted window
+func (env *testMFAEnv) wrongCode() string {
+	for step := mfa.Step(time.Now()) - 100; ; step-- {
+		code := mfa.Code(env.secret, step)
+		if _, ok := mfa.Verify(env.secret, code, time.Now(), testMFACfg.Skew); !ok {
+			return code
+		}
+	}
+}
+
+func (env *testMFAEnv) challenge(t *testing.T) string {
+	t.Helper()
+
+	challenge, err := env.s.CreateMFAChallenge(1, "alice", &model.ClientInfo{ClientIP: "192.0.2.1", DeviceName: "laptop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return challenge.ChallengeToken
+}
+
+func TestMFAChallengeCode(t *testing.T) {
+
+	env := newTestMFAService(t, testLockoutCfg)
+
+	token := env.challenge(t)
+
+	_, _, err := env.s.VerifyMFAChallenge(token, env.wrongCode(), "")
+	if !errors.Is(err, ErrMFACodeInvalid) {
+		t.Fatalf("VerifyMFAChallenge() with a wrong code error = %v, want %v", err, ErrMFACodeInvalid)
+	}
+
+	// a wrong code leaves the challenge open
+	userID, client, err := env.s.VerifyMFAChallenge(token, env.code(), "")
+	if err != nil {
+		t.Fatalf("VerifyMFAChallenge() error = %v", err)
+	}
+	if userID != 1 || client.DeviceName != "laptop" || client.ClientIP != "192.0.2.1" {
+		t.Errorf("VerifyMFAChallenge() = %d, %+v, want user 1 on the laptop", userID, client)
+	}
+
+	// the challenge is used up
+	_, _, err = env.s.VerifyMFAChallenge(token, env.code(), "")
+	if !errors.Is(err, ErrMFAChallengeInvalid) {
+		t.Errorf("VerifyMFAChallenge() of a used challenge error = %v, want %v", err, ErrMFAChallengeInvalid)
+	}
+
+	// and so is the code
+	_, _, err = env.s.VerifyMFAChallenge(env.challenge(t), env.code(), "")
+	if !errors.Is(err, ErrMFACodeInvalid) {
+		t.Errorf("VerifyMFAChallenge() with a used code error = %v, want %v", err, ErrMFACodeInvalid)
+	}
+}
+
+func TestMFAChallengeRecoveryCode(t *testing.T) {
+
+	env := newTestMFAService(t, testLockoutCfg)
+
+	_, _, err := env.s.VerifyMFAChallenge(env.challenge(t), "", env.recovery[0])
+	if err != nil {
+		t.Fatalf("VerifyMFAChallenge() with a recovery code error = %v", err)
+	}
+
+	_, _, err = env.s.VerifyMFAChallenge(env.challenge(t), "", env.recovery[0])
+	if !errors.Is(err, ErrMFACodeInvalid) {
+		t.Errorf("VerifyMFAChallenge() with a used recovery code error = %v, want %v", err, ErrMFACodeInvalid)
+	}
+
+	remaining, _ := env.mfa.CountRecoveryCodes(1)
+	if remaining != len(env.recovery)-1 {
+		t.Errorf("%d recovery codes left, want %d", remaining, len(env.recovery)-1)
+	}
+
+	if got := env.publisher.count(SubjectRecoveryCodeUsed); got != 1 {
+		t.Errorf("%d %s events, want 1", got, SubjectRecoveryCodeUsed)
+	}
+}
+
+func TestMFAChallengeClaimed(t *testing.T) {
+
+	env := newTestMFAService(t, testLockoutCfg)
+
+	token := env.challenge(t)
+
+	// a concurrent attempt holds the challenge
+	env.server.HSet(mfaChallengeKey(token), "claimed", "1")
+
+	_, _, err := env.s.VerifyMFAChallenge(token, "", env.recovery[0])
+	if !errors.Is(err, ErrMFAChallengeInvalid) {
+		t.Fatalf("VerifyMFAChallenge() of a claimed challenge error = %v, want %v", err, ErrMFAChallengeInvalid)
+	}
+
+	remaining, _ := env.mfa.CountRecoveryCodes(1)
+	if remaining != len(env.recovery) {
+		t.Errorf("a claimed challenge burnt a recovery code")
+	}
+
+	// the attempt is over, the challenge takes the next one
+	env.server.HDel(mfaChallengeKey(token), "claimed")
+
+	_, _, err = env.s.VerifyMFAChallenge(token, "", env.recovery[0])
+	if err != nil {
+		t.Errorf("VerifyMFAChallenge() error = %v", err)
+	}
+}
+
+func TestMFAChallengeMaxAttempts(t *testing.T) {
+
+	env := newTestMFAService(t, config.LockoutCfg{})
+
+	token := env.challenge(t)
+
+	for i := 0; i < testMFACfg.MaxAttempts; i++ {
+		_, _, err := env.s.VerifyMFAChallenge(token, env.wrongCode(), "")
+		if !errors.Is(err, ErrMFACodeInvalid) {
+			t.Fatalf("attempt %d error = %v, want %v", i+1, err, ErrMFACodeInvalid)
+		}
+	}
+
+	// the challenge is burnt, even the right code needs a new password step
+	_, _, err := env.s.VerifyMFAChallenge(token, env.code(), "")
+	if !errors.Is(err, ErrMFAChallengeInvalid) {
+		t.Errorf("VerifyMFAChallenge() after %d wrong codes error = %v, want %v", testMFACfg.MaxAttempts, err, ErrMFAChallengeInvalid)
+	}
+
+	if env.server.Exists(mfaChallengeKey(token)) {
+		t.Errorf("burnt challenge still stored")
+	}
+}
+
+func TestMFAChallengeWrongCodesLock(t *testing.T) {
+
+	cfg := testLockoutCfg
+	cfg.MaxFailures = 2
+
+	env := newTestMFAService(t, cfg)
+
+	for i := 0; i < cfg.MaxFailures; i++ {
+		_, _, err := env.s.VerifyMFAChallenge(env.challenge(t), env.wrongCode(), "")
+		if !errors.Is(err, ErrMFACodeInvalid) {
+			t.Fatalf("attempt %d error = %v, want %v", i+1, err, ErrMFACodeInvalid)
+		}
+	}
+
+	_, _, err := env.s.VerifyMFAChallenge(env.challenge(t), env.code(), "")
+	if !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("VerifyMFAChallenge() after %d wrong codes error = %v, want %v", cfg.MaxFailures, err, ErrAccountLocked)
+	}
+}
+
+func TestMFAChallengeExpired(t *testing.T) {
+
+	env := newTestMFAService(t, testLockoutCfg)
+
+	token := env.challenge(t)
+
+	env.server.FastForward(testMFACfg.ChallengeTTL + time.Second)
+
+	_, _, err := env.s.VerifyMFAChallenge(token, env.code(), "")
+	if !errors.Is(err, ErrMFAChallengeInvalid) {
+		t.Errorf("VerifyMFAChallenge() of an expired challenge error = %v, want %v", err, ErrMFAChallengeInvalid)
+	}
+}
+
+func TestMFAChallengeDeletedUser(t *testing.T) {
+
+	env := newTestMFAService(t, testLockoutCfg)
+
+	token := env.challenge(t)
+
+	// the account is deleted between the password and the code
+	env.users.users = nil
+
+	_, _, err := env.s.VerifyMFAChallenge(token, env.code(), "")
+	if !errors.Is(err, ErrMFAChallengeInvalid) {
+		t.Errorf("VerifyMFAChallenge() of a deleted user error = %v, want %v", err, ErrMFAChallengeInvalid)
+	}
+
+	if env.server.Exists(mfaChallengeKey(token)) {
+		t.Errorf("challenge of a deleted user still stored")
+	}
+}
+
+func TestConfirmMFA(t *testing.T) {
+
+	env := newTestMFAService(t, testLockoutCfg)
+
+	// alice starts over
+	delete(env.mfa.enrolments, 1)
+
+	_, err := env.s.EnrollMFA(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed := env.mfa.enrolments[1].Secret
+	env.secret, err = env.s.cipher.Open(sealed, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codes, err := env.s.ConfirmMFA(1, env.code())
+	if err != nil {
+		t.Fatalf("ConfirmMFA() error = %v", err)
+	}
+	if len(codes.RecoveryCodes) != testMFACfg.RecoveryCodes {
+		t.Errorf("ConfirmMFA() gave %d recovery codes, want %d", len(codes.RecoveryCodes), testMFACfg.RecoveryCodes)
+	}
+
+	_, err = env.s.ConfirmMFA(1, env.code())
+	if err == nil {
+		t.Errorf("ConfirmMFA() of an enabled enrolment succeeded")
+	}
+
+	remaining, _ := env.mfa.CountRecoveryCodes(1)
+	if remaining != testMFACfg.RecoveryCodes {
+		t.Errorf("%d recovery codes stored, want %d", remaining, testMFACfg.RecoveryCodes)
+	}
+}
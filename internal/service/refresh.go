@@ -0,0 +1,131 @@
+package service
+
+import (
+	"fmt"
+	"github.com/go-redis/redis"
+	"strconv"
+	"user/internal/model"
+)
+
+// TokenReuseError is returned when an already rotated refresh token is
+// presented again. Either the legitimate client or an attacker holds a copy,
+// so the whole family has been revoked.
+type TokenReuseError struct {
+	UserID      int
+	FamilyID    string
+	RefreshUuid string
+}
+
+func (e *TokenReuseError) Error() string {
+	return fmt.Sprintf("refresh token %s of family %s reused", e.RefreshUuid, e.FamilyID)
+}
+
+func familyKey(familyID string) string {
+	return "family:" + familyID
+}
+
+// every access uuid issued in the family, a rotated access token stays valid
+// until it expires and must be revoked with the family
+func familyTokensKey(familyID string) string {
+	return "family_tokens:" + familyID
+}
+
+// RefreshToken rotates the refresh token: the presented one is consumed and a
+// new pair is issued in the same family.
+func (s *TokenService) RefreshToken(refreshToken string) (*model.TokenDetails, error) {
+
+	refreshDetails, err := s.VerifyRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// DEL is atomic, only one of two concurrent refreshes can consume the token
+	deleted, err := s.DeleteAuth(refreshDetails.RefreshUuid)
+	if err != nil {
+		return nil, err
+	}
+
+	if deleted == 0 {
+		familyExists, err := s.redis.Exists(familyKey(refreshDetails.FamilyID)).Result()
+		if err != nil {
+			s.logger.Error(err)
+			return nil, err
+		}
+		// the token is signed and not expired, yet already consumed
+		if familyExists == 0 {
+			return nil, ErrTokenRevoked
+		}
+
+		err = s.RevokeFamily(refreshDetails.FamilyID)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, &TokenReuseError{
+			UserID:      refreshDetails.UserId,
+			FamilyID:    refreshDetails.FamilyID,
+			RefreshUuid: refreshDetails.RefreshUuid,
+		}
+	}
+
+	td, err := s.CreateToken(refreshDetails.UserId, &model.TokenFamily{
+		ID:       refreshDetails.FamilyID,
+		ClientID: refreshDetails.ClientID,
+		AuthTime: refreshDetails.AuthTime,
+	})
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+
+	err = s.CreateAuth(refreshDetails.UserId, td)
+	if err != nil {
+		return nil, err
+	}
+
+	return td, nil
+}
+
+// RevokeFamily deletes every token issued in the family and the family itself
+func (s *TokenService) RevokeFamily(familyID string) error {
+
+	family, err := s.redis.HGetAll(familyKey(familyID)).Result()
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	uuids, err := s.redis.SMembers(familyTokensKey(familyID)).Result()
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	// families issued before the set existed only know their current pair
+	if len(uuids) == 0 {
+		if family["access_uuid"] != "" {
+			uuids = append(uuids, family["access_uuid"])
+		}
+		if family["refresh_uuid"] != "" {
+			uuids = append(uuids, family["refresh_uuid"])
+		}
+	}
+
+	userID, _ := strconv.Atoi(family["user_id"])
+
+	_, err = s.redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Del(append(uuids, familyKey(familyID), familyTokensKey(familyID))...)
+		if userID != 0 {
+			pipe.SRem(userSessionsKey(userID), familyID)
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	s.publishRevoked(userID, uuids)
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"testing"
+	"time"
+	"user/config"
+	"user/internal/keys"
+	"user/internal/logging"
+	"user/internal/model"
+)
+
+// testPublisher keeps the subjects of the published events
+type testPublisher struct {
+	subjects []string
+}
+
+func (p *testPublisher) Publish(subject string, data []byte) error {
+	p.subjects = append(p.subjects, subject)
+	return nil
+}
+
+func (p *testPublisher) count(subject string) int {
+	count := 0
+	for _, published := range p.subjects {
+		if published == subject {
+			count++
+		}
+	}
+	return count
+}
+
+func newTestRedis(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return client, server
+}
+
+func newTestTokenService(t *testing.T) (*TokenService, *testPublisher) {
+	t.Helper()
+
+	client, _ := newTestRedis(t)
+
+	cfg := config.TokenCfg{
+		SigningAlgorithm: "HS256",
+		AccessSecret:     "access-8Fq2LmN4pR7sT9vW1yB3dK5hJ6gH0",
+		RefreshSecret:    "refresh-Zx8kq2LmN4pR7sT9vW1yB3dF5hJ6",
+		MinSecretLength:  32,
+		Scope:            "user",
+		Issuer:           "user-service",
+		Audience:         "api",
+		AccessTTL:        time.Minute,
+		RefreshTTL:       time.Hour,
+		MaxSessionAge:    2 * time.Hour,
+	}
+
+	signingKeys, err := keys.Load(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publisher := &testPublisher{}
+
+	return NewTokenService(nil, logging.GetLogger(), client, signingKeys, cfg, publisher), publisher
+}
+
+func signIn(t *testing.T, s *TokenService, userID int) *model.TokenDetails {
+	t.Helper()
+
+	td, err := s.CreateToken(userID, &model.TokenFamily{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.CreateAuth(userID, td)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return td
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+
+	s, _ := newTestTokenService(t)
+
+	first := signIn(t, s, 7)
+
+	second, err := s.RefreshToken(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+	if second.FamilyID != first.FamilyID {
+		t.Errorf("family = %s, want %s", second.FamilyID, first.FamilyID)
+	}
+
+	third, err := s.RefreshToken(second.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken() of the rotated token error = %v", err)
+	}
+
+	// access tokens stay valid until they expire or the family is revoked
+	for _, td := range []*model.TokenDetails{first, second, third} {
+		_, err = s.VerifyAccessToken(td.AccessToken)
+		if err != nil {
+			t.Errorf("VerifyAccessToken() error = %v", err)
+		}
+	}
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+
+	s, publisher := newTestTokenService(t)
+
+	first := signIn(t, s, 7)
+
+	second, err := s.RefreshToken(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+
+	_, err = s.RefreshToken(first.RefreshToken)
+	var reuseErr *TokenReuseError
+	if !errors.As(err, &reuseErr) {
+		t.Fatalf("RefreshToken() of a consumed token error = %v, want a TokenReuseError", err)
+	}
+	if reuseErr.UserID != 7 || reuseErr.FamilyID != first.FamilyID {
+		t.Errorf("TokenReuseError = %+v, want user 7 of family %s", reuseErr, first.FamilyID)
+	}
+
+	// the whole family is gone, the newer refresh token included
+	_, err = s.RefreshToken(second.RefreshToken)
+	if !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("RefreshToken() after the reuse error = %v, want %v", err, ErrTokenRevoked)
+	}
+
+	for _, td := range []*model.TokenDetails{first, second} {
+		_, err = s.VerifyAccessToken(td.AccessToken)
+		if err == nil {
+			t.Errorf("VerifyAccessToken() of family %s succeeded after the reuse", td.FamilyID)
+		}
+	}
+
+	if got := publisher.count(SubjectTokensRevoked); got != 1 {
+		t.Errorf("%d %s events, want 1", got, SubjectTokensRevoked)
+	}
+}
+
+func TestRefreshTokenReuseKeepsOtherFamilies(t *testing.T) {
+
+	s, _ := newTestTokenService(t)
+
+	stolen := signIn(t, s, 7)
+	other := signIn(t, s, 7)
+
+	_, err := s.RefreshToken(stolen.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+
+	_, err = s.RefreshToken(stolen.RefreshToken)
+	var reuseErr *TokenReuseError
+	if !errors.As(err, &reuseErr) {
+		t.Fatalf("RefreshToken() of a consumed token error = %v, want a TokenReuseError", err)
+	}
+
+	_, err = s.VerifyAccessToken(other.AccessToken)
+	if err != nil {
+		t.Errorf("VerifyAccessToken() of another session error = %v", err)
+	}
+
+	_, err = s.RefreshToken(other.RefreshToken)
+	if err != nil {
+		t.Errorf("RefreshToken() of another session error = %v", err)
+	}
+}
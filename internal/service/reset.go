@@ -0,0 +1,155 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-redis/redis"
+	"time"
+	"user/config"
+	"user/internal/logging"
+	"user/internal/model"
+	"user/internal/repository"
+)
+
+const SubjectPasswordResetNotification = "notifications.password-reset"
+
+type PasswordResetService struct {
+	rep       *repository.Repository
+	logger    *logging.Logger
+	links     *singleUseTokens
+	users     *UserService
+	tokens    Token
+	cfg       config.ResetCfg
+	publisher Publisher
+}
+
+func NewPasswordResetService(rep *repository.Repository, log *logging.Logger, redis *redis.Client, users *UserService, tokens Token, cfg config.ResetCfg, publisher Publisher) *PasswordResetService {
+	return &PasswordResetService{
+		rep:       rep,
+		logger:    log,
+		links:     newSingleUseTokens(redis, "password_reset", cfg.TokenTTL),
+		users:     users,
+		tokens:    tokens,
+		cfg:       cfg,
+		publisher: publisher,
+	}
+}
+
+// RequestPasswordReset issues a reset token and hands it to the mailer. An
+// unknown name is not an error, the caller must not learn whether it exists.
+func (s *PasswordResetService) RequestPasswordReset(name string) error {
+
+	user, err := s.users.findUser(name)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	profile, err := s.rep.GetProfile(user.ID)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	// an unverified address may not belong to the user at all
+	if profile.Email == "" || profile.EmailVerifiedAt == nil {
+		s.logger.Warnf("password reset of user %d skipped, no verified email address", user.ID)
+		return nil
+	}
+
+	expiresAt := time.Now().Add(s.cfg.TokenTTL)
+
+	token, err := s.links.issue(user.ID, nil)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	notification := model.PasswordResetNotification{
+		UserID:    user.ID,
+		Name:      user.Name,
+		Email:     profile.Email,
+		Locale:    profile.Locale,
+		Token:     token,
+		Link:      tokenLink(s.cfg.LinkURL, token),
+		ExpiresAt: expiresAt.UTC(),
+	}
+
+	notificationBytes, err := json.Marshal(notification)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	err = s.publisher.Publish(SubjectPasswordResetNotification, notificationBytes)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	s.logger.Infof("password reset requested for user %d", user.ID)
+
+	return nil
+}
+
+// ConfirmPasswordReset sets the new password and signs the user out
+// everywhere. A password the policy refuses leaves the token usable, any other
+// outcome uses it up.
+func (s *PasswordResetService) ConfirmPasswordReset(token, password string) error {
+
+	userID, _, err := s.links.lookup(token)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	if userID == 0 {
+		return ErrResetTokenInvalid
+	}
+
+	user, err := s.rep.GetUserByID(userID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return ErrResetTokenInvalid
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	hash, err := s.users.newPasswordHash(user, password)
+	if err != nil {
+		return err
+	}
+
+	used, err := s.links.use(token, userID)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	if !used {
+		return ErrResetTokenInvalid
+	}
+
+	changed, err := s.rep.ChangePassword(userID, user.Password, hash)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	if !changed {
+		return ErrPasswordConflict
+	}
+
+	s.logger.Infof("password of user %d reset", userID)
+
+	err = s.tokens.RevokeUserTokens(userID)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	s.users.publishPasswordChanged(userID, "reset")
+
+	return nil
+}
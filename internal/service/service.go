@@ -2,9 +2,14 @@ package service
 
 import (
 	"github.com/go-redis/redis"
+	"user/config"
+	"user/internal/keys"
 	"user/internal/logging"
+	"user/internal/mfa"
 	"user/internal/model"
+	"user/internal/password"
 	"user/internal/repository"
+	"user/pkg/jwk"
 )
 
 type User interface {
@@ -14,22 +19,87 @@ type User interface {
 	GenerateHash(password string) (string, error)
 	CompareHashPassword(passFromDb, passFromUser string) error
 	ExistsUser(userName string) (bool, error)
+	GetProfile(userID int) (*model.Profile, error)
+	UpdateProfile(userID int, update *model.ProfileUpdate) (*model.Profile, error)
+	ChangePassword(userID int, sessionID string, change *model.PasswordChange) error
 }
 
 type Token interface {
-	CreateToken(userID int) (*model.TokenDetails, error)
+	CreateToken(userID int, family *model.TokenFamily) (*model.TokenDetails, error)
 	CreateAuth(userID int, td *model.TokenDetails) error
 	DeleteAuth(giveUuid string) (int64, error)
+	RefreshToken(refreshToken string) (*model.TokenDetails, error)
+	RevokeFamily(familyID string) error
+	CreateSession(userID int, td *model.TokenDetails, client *model.ClientInfo) error
+	ListSessions(userID int) ([]model.Session, error)
+	RevokeSession(userID int, sessionID string) error
+	RevokeUserTokens(userID int) error
+	RevokeOtherSessions(userID int, keepSessionID string) error
+	IntrospectToken(token, tokenTypeHint string) (*model.Introspection, error)
+	VerifyAccessToken(tokenString string) (*model.AccessDetails, error)
+	VerifyRefreshToken(tokenString string) (*model.RefreshDetails, error)
+	JWKS() (*jwk.JWKS, error)
+	RotateKeys() (*jwk.JWKS, error)
+	ReloadKeys() error
+}
+
+type Lockout interface {
+	CheckLogin(name, source string) error
+	RecordLoginFailure(name, source string) error
+	RecordLoginSuccess(name string) error
+	ClearLockout(name, source string) error
+}
+
+type MFA interface {
+	MFAEnabled(userID int) (bool, error)
+	EnrollMFA(userID int) (*model.MFAEnrollment, error)
+	ConfirmMFA(userID int, code string) (*model.RecoveryCodes, error)
+	DisableMFA(userID int, code string) error
+	RegenerateRecoveryCodes(userID int, code string) (*model.RecoveryCodes, error)
+	MFAStatus(userID int) (*model.MFAStatus, error)
+	CreateMFAChallenge(userID int, name string, client *model.ClientInfo) (*model.MFAChallenge, error)
+	VerifyMFAChallenge(challengeToken, code, recoveryCode string) (int, *model.ClientInfo, error)
+}
+
+type PasswordReset interface {
+	RequestPasswordReset(name string) error
+	ConfirmPasswordReset(token, password string) error
+}
+
+type Email interface {
+	SendEmailVerification(userID int) error
+	RequestEmailVerification(name string) error
+	ConfirmEmailVerification(token string) error
+}
+
+type Account interface {
+	DeleteAccount(userID int, password string) error
+	RestoreAccount(name, password string) error
+	PurgeDeletedAccounts() (int, error)
 }
 
 type Service struct {
 	User
 	Token
+	Lockout
+	MFA
+	PasswordReset
+	Email
+	Account
 }
 
-func NewService(rep *repository.Repository, log *logging.Logger, redis *redis.Client) *Service {
+func NewService(rep *repository.Repository, log *logging.Logger, redis *redis.Client, keys *keys.Keys, cfg *config.Config, publisher Publisher, policy *password.Policy, hashers *password.Hashers, cipher *mfa.Cipher) *Service {
+	tokenService := NewTokenService(rep, log, redis, keys, cfg.TokenCfg, publisher)
+	userService := NewUserService(rep, log, tokenService, policy, hashers, publisher, cfg.EmailCfg)
+	lockoutService := NewLockoutService(log, redis, userService, cfg.LockoutCfg, publisher)
+
 	return &Service{
-		User:  NewUserService(rep, log),
-		Token: NewTokenService(rep, log, redis),
+		User:          userService,
+		Token:         tokenService,
+		Lockout:       lockoutService,
+		MFA:           NewMFAService(rep, log, redis, cipher, cfg.MFACfg, publisher, lockoutService),
+		PasswordReset: NewPasswordResetService(rep, log, redis, userService, tokenService, cfg.ResetCfg, publisher),
+		Email:         NewEmailService(rep, log, redis, userService, cfg.EmailCfg, publisher),
+		Account:       NewAccountService(rep, log, userService, tokenService, cfg.AccountCfg, publisher),
 	}
 }
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+	"user/internal/model"
+)
+
+func userSessionsKey(userID int) string {
+	return "user_sessions:" + strconv.Itoa(userID)
+}
+
+func userTokensKey(userID int) string {
+	return "user_tokens:" + strconv.Itoa(userID)
+}
+
+// CreateSession records the client of a fresh sign-in on the family created by CreateAuth
+func (s *TokenService) CreateSession(userID int, td *model.TokenDetails, client *model.ClientInfo) error {
+
+	err := s.redis.HMSet(familyKey(td.FamilyID), map[string]interface{}{
+		"created":     time.Now().Unix(),
+		"client_id":   client.ClientID,
+		"client_ip":   client.ClientIP,
+		"user_agent":  client.UserAgent,
+		"device_name": client.DeviceName,
+	}).Err()
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *TokenService) ListSessions(userID int) ([]model.Session, error) {
+
+	sessionIDs, err := s.redis.SMembers(userSessionsKey(userID)).Result()
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+
+	sessions := []model.Session{}
+
+	for _, sessionID := range sessionIDs {
+		session, err := s.getSession(sessionID)
+		if errors.Is(err, ErrSessionNotFound) {
+			// the family has expired, drop it from the index
+			s.redis.SRem(userSessionsKey(userID), sessionID)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, *session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsed.After(sessions[j].LastUsed)
+	})
+
+	return sessions, nil
+}
+
+func (s *TokenService) RevokeSession(userID int, sessionID string) error {
+
+	session, err := s.getSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	// a user can only see and revoke their own sessions
+	if session.UserID != userID {
+		return ErrSessionNotFound
+	}
+
+	return s.RevokeFamily(sessionID)
+}
+
+func (s *TokenService) getSession(sessionID string) (*model.Session, error) {
+
+	family, err := s.redis.HGetAll(familyKey(sessionID)).Result()
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+
+	if len(family) == 0 {
+		return nil, ErrSessionNotFound
+	}
+
+	userID, err := strconv.Atoi(family["user_id"])
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Session{
+		ID:         sessionID,
+		UserID:     userID,
+		Created:    unixField(family["created"]),
+		LastUsed:   unixField(family["last_used"]),
+		ClientID:   family["client_id"],
+		ClientIP:   family["client_ip"],
+		UserAgent:  family["user_agent"],
+		DeviceName: family["device_name"],
+	}, nil
+}
+
+func unixField(value string) time.Time {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(seconds, 0).UTC()
+}
+
+// RevokeUserTokens signs the user out everywhere: every token uuid and every
+// session of the user is deleted.
+func (s *TokenService) RevokeUserTokens(userID int) error {
+
+	tokenUuids, err := s.redis.SMembers(userTokensKey(userID)).Result()
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	sessionIDs, err := s.redis.SMembers(userSessionsKey(userID)).Result()
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	keys := append(tokenUuids, userTokensKey(userID), userSessionsKey(userID))
+	for _, sessionID := range sessionIDs {
+		keys = append(keys, familyKey(sessionID), familyTokensKey(sessionID))
+	}
+
+	err = s.redis.Del(keys...).Err()
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	s.publishRevoked(userID, tokenUuids)
+
+	return nil
+}
+
+// RevokeOtherSessions ends every session of the user but the one given, which
+// is usually the session making the request.
+func (s *TokenService) RevokeOtherSessions(userID int, keepSessionID string) error {
+
+	sessionIDs, err := s.redis.SMembers(userSessionsKey(userID)).Result()
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	for _, sessionID := range sessionIDs {
+		if sessionID == keepSessionID {
+			continue
+		}
+
+		err = s.RevokeFamily(sessionID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/go-redis/redis"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// singleUseTokens back the links sent by mail. Only the hash of a token is
+// stored, a leaked Redis dump can't use the links, and a user has at most one
+// pending token of each kind: issuing a new one invalidates the previous link.
+type singleUseTokens struct {
+	redis  *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+func newSingleUseTokens(redis *redis.Client, prefix string, ttl time.Duration) *singleUseTokens {
+	return &singleUseTokens{
+		redis:  redis,
+		prefix: prefix,
+		ttl:    ttl,
+	}
+}
+
+func (t *singleUseTokens) key(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return t.prefix + ":" + hex.EncodeToString(sum[:])
+}
+
+func (t *singleUseTokens) userKey(userID int) string {
+	return t.prefix + "_user:" + strconv.Itoa(userID)
+}
+
+// issue stores the values with a fresh token of the user and returns it
+func (t *singleUseTokens) issue(userID int, values map[string]interface{}) (string, error) {
+
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	key := t.key(token)
+
+	previous, err := t.redis.Get(t.userKey(userID)).Result()
+	if err != nil && err != redis.Nil {
+		return "", err
+	}
+
+	fields := map[string]interface{}{"user_id": userID}
+	for field, value := range values {
+		fields[field] = value
+	}
+
+	_, err = t.redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		if previous != "" {
+			pipe.Del(previous)
+		}
+		pipe.HMSet(key, fields)
+		pipe.Expire(key, t.ttl)
+		pipe.Set(t.userKey(userID), key, t.ttl)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// lookup returns the user and the values of a pending token, the user is zero
+// when the token is unknown or expired
+func (t *singleUseTokens) lookup(token string) (int, map[string]string, error) {
+
+	values, err := t.redis.HGetAll(t.key(token)).Result()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	userID, err := strconv.Atoi(values["user_id"])
+	if err != nil {
+		return 0, nil, nil
+	}
+
+	return userID, values, nil
+}
+
+// use consumes the token, false means a concurrent use of the same token won
+func (t *singleUseTokens) use(token string, userID int) (bool, error) {
+
+	deleted, err := t.redis.Del(t.key(token)).Result()
+	if err != nil {
+		return false, err
+	}
+	if deleted == 0 {
+		return false, nil
+	}
+
+	t.redis.Del(t.userKey(userID))
+
+	return true, nil
+}
+
+// randomToken is an opaque single-use token for a link sent by mail
+func randomToken() (string, error) {
+
+	tokenBytes := make([]byte, 32)
+
+	_, err := rand.Read(tokenBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(tokenBytes), nil
+}
+
+// tokenLink puts the token into the token query parameter of the configured
+// page, no page means the mailer builds the link itself.
+func tokenLink(page, token string) string {
+
+	if page == "" {
+		return ""
+	}
+
+	link, err := url.Parse(page)
+	if err != nil {
+		return ""
+	}
+
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return link.String()
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestSingleUseTokens(t *testing.T) (*singleUseTokens, func(time.Duration), func() []string) {
+	t.Helper()
+
+	client, server := newTestRedis(t)
+
+	return newSingleUseTokens(client, "password_reset", time.Hour), server.FastForward, server.Keys
+}
+
+func TestSingleUseTokenUse(t *testing.T) {
+
+	tokens, _, keys := newTestSingleUseTokens(t)
+
+	token, err := tokens.issue(7, map[string]interface{}{"email": "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the hash of the token is stored
+	for _, key := range keys() {
+		if strings.Contains(key, token) {
+			t.Errorf("key %s holds the token", key)
+		}
+	}
+
+	userID, values, err := tokens.lookup(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID != 7 || values["email"] != "alice@example.com" {
+		t.Errorf("lookup() = %d, %v, want user 7 with the address", userID, values)
+	}
+
+	used, err := tokens.use(token, userID)
+	if err != nil || !used {
+		t.Fatalf("use() = %v, %v, want true", used, err)
+	}
+
+	used, err = tokens.use(token, userID)
+	if err != nil || used {
+		t.Errorf("second use() = %v, %v, want false", used, err)
+	}
+
+	userID, _, err = tokens.lookup(token)
+	if err != nil || userID != 0 {
+		t.Errorf("lookup() of a used token = %d, %v, want 0", userID, err)
+	}
+
+	if left := keys(); len(left) != 0 {
+		t.Errorf("keys left after use: %v", left)
+	}
+}
+
+func TestSingleUseTokenReplaced(t *testing.T) {
+
+	tokens, _, _ := newTestSingleUseTokens(t)
+
+	first, err := tokens.issue(7, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := tokens.issue(7, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a new link invalidates the previous one
+	userID, _, err := tokens.lookup(first)
+	if err != nil || userID != 0 {
+		t.Errorf("lookup() of the replaced token = %d, %v, want 0", userID, err)
+	}
+
+	used, err := tokens.use(first, 7)
+	if err != nil || used {
+		t.Errorf("use() of the replaced token = %v, %v, want false", used, err)
+	}
+
+	// the tokens of other users stay
+	other, err := tokens.issue(8, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{second, other} {
+		userID, _, err = tokens.lookup(token)
+		if err != nil || userID == 0 {
+			t.Errorf("lookup() = %d, %v, want a user", userID, err)
+		}
+	}
+}
+
+func TestSingleUseTokenExpired(t *testing.T) {
+
+	tokens, fastForward, _ := newTestSingleUseTokens(t)
+
+	token, err := tokens.issue(7, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fastForward(time.Hour + time.Second)
+
+	userID, _, err := tokens.lookup(token)
+	if err != nil || userID != 0 {
+		t.Errorf("lookup() of an expired token = %d, %v, want 0", userID, err)
+	}
+
+	used, err := tokens.use(token, 7)
+	if err != nil || used {
+		t.Errorf("use() of an expired token = %v, %v, want false", used, err)
+	}
+}
+
+func TestSingleUseTokenConcurrentUse(t *testing.T) {
+
+	tokens, _, _ := newTestSingleUseTokens(t)
+
+	token, err := tokens.issue(7, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		wins int
+	)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			used, err := tokens.use(token, 7)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if used {
+				mu.Lock()
+				wins++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if wins != 1 {
+		t.Errorf("%d concurrent uses won, want 1", wins)
+	}
+}
+
+func TestTokenLink(t *testing.T) {
+
+	tests := []struct {
+		name string
+		page string
+		want string
+	}{
+		{"no page", "", ""},
+		{"page", "https://example.com/reset", "https://example.com/reset?token=abc"},
+		{"page with a query", "https://example.com/reset?lang=de", "https://example.com/reset?lang=de&token=abc"},
+		{"token replaced", "https://example.com/reset?token=old", "https://example.com/reset?token=abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tokenLink(tt.page, "abc"); got != tt.want {
+				t.Errorf("tokenLink() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,68 +1,139 @@
 package service
 
 import (
+	"errors"
+	"fmt"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/go-redis/redis"
 	"github.com/twinj/uuid"
-	"os"
+	"strconv"
 	"time"
+	"user/config"
+	"user/internal/keys"
 	"user/internal/logging"
 	"user/internal/model"
 	"user/internal/repository"
+	"user/pkg/claims"
+	"user/pkg/jwk"
 )
 
 type TokenService struct {
-	rep    *repository.Repository
-	logger *logging.Logger
-	redis  *redis.Client
+	rep       *repository.Repository
+	logger    *logging.Logger
+	redis     *redis.Client
+	keys      *keys.Keys
+	scope     string
+	publisher Publisher
+
+	issuer          string
+	defaultAudience string
+	audiences       []string
+	clients         map[string]config.ClientCfg
+	defaultPolicy   lifetimePolicy
+	maxSessionAge   time.Duration
 }
 
-func NewTokenService(rep *repository.Repository, log *logging.Logger, redis *redis.Client) *TokenService {
+func NewTokenService(rep *repository.Repository, log *logging.Logger, redis *redis.Client, keys *keys.Keys, cfg config.TokenCfg, publisher Publisher) *TokenService {
+
+	// access tokens are accepted for any audience this service issues them for
+	audiences := []string{cfg.Audience}
+	maxSessionAge := cfg.MaxSessionAge
+	for _, client := range cfg.Clients {
+		if client.Audience != "" {
+			audiences = append(audiences, client.Audience)
+		}
+		if client.MaxSessionAge > maxSessionAge {
+			maxSessionAge = client.MaxSessionAge
+		}
+	}
+
 	return &TokenService{
-		rep:    rep,
-		logger: log,
-		redis:  redis,
+		rep:             rep,
+		logger:          log,
+		redis:           redis,
+		keys:            keys,
+		scope:           cfg.Scope,
+		publisher:       publisher,
+		issuer:          cfg.Issuer,
+		defaultAudience: cfg.Audience,
+		audiences:       audiences,
+		clients:         cfg.Clients,
+		defaultPolicy:   newLifetimePolicy(cfg),
+		maxSessionAge:   maxSessionAge,
 	}
 }
 
-func (s *TokenService) CreateToken(userID int) (*model.TokenDetails, error) {
+// CreateToken issues a new token pair in the family. The lifetimes follow the
+// policy of the family's client and never outlive the maximum session age.
+func (s *TokenService) CreateToken(userID int, family *model.TokenFamily) (*model.TokenDetails, error) {
+
+	audience, err := s.audienceFor(family.ClientID)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := s.policyFor(family.ClientID)
 
 	var td model.TokenDetails
 
-	td.AtExpires = time.Now().Add(15 * time.Minute).Unix()
-	td.AccessUuid = uuid.NewV4().String()
+	now := time.Now()
 
-	td.RtExpires = time.Now().Add(time.Hour * 24 * 7).Unix()
+	td.FamilyID = family.ID
+	td.AuthTime = family.AuthTime
+	if td.FamilyID == "" {
+		td.FamilyID = uuid.NewV4().String()
+		td.AuthTime = now.Unix()
+	}
+
+	td.AtExpires, td.RtExpires = policy.expiries(now, time.Unix(td.AuthTime, 0))
+	td.AccessUuid = uuid.NewV4().String()
 	td.RefreshUuid = uuid.NewV4().String()
 
 	// Creating Access Token
-	err := os.Setenv("ACCESS_SECRET", "secret")
-	if err != nil {
-		return nil, err
+	atClaims := &claims.Access{
+		StandardClaims: jwt.StandardClaims{
+			Id:        td.AccessUuid,
+			Issuer:    s.issuer,
+			Audience:  audience,
+			Subject:   strconv.Itoa(userID),
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: td.AtExpires,
+		},
+		Version:   claims.Version,
+		SessionID: td.FamilyID,
+		ClientID:  family.ClientID,
+		Scope:     s.scope,
+		AuthTime:  td.AuthTime,
 	}
-
-	atClaims := jwt.MapClaims{}
-	atClaims["authorized"] = true
-	atClaims["access_uuid"] = td.AccessUuid
-	atClaims["user_id"] = userID
-	atClaims["exp"] = td.AtExpires
-	at := jwt.NewWithClaims(jwt.SigningMethodHS256, atClaims)
-	td.AccessToken, err = at.SignedString([]byte(os.Getenv("ACCESS_SECRET")))
+	signingKey := s.keys.Access.Active()
+	at := jwt.NewWithClaims(signingKey.Method, atClaims)
+	if signingKey.ID != "" {
+		at.Header["kid"] = signingKey.ID
+	}
+	td.AccessToken, err = at.SignedString(signingKey.PrivateKey)
 	if err != nil {
 		return nil, err
 	}
 
-	// Creating Refresh Token
-	err = os.Setenv("REFRESH_SECRET", "secret")
-	if err != nil {
-		return nil, err
+	// Creating Refresh Token, only this service consumes it
+	rtClaims := &claims.Refresh{
+		StandardClaims: jwt.StandardClaims{
+			Id:        td.RefreshUuid,
+			Issuer:    s.issuer,
+			Audience:  s.issuer,
+			Subject:   strconv.Itoa(userID),
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: td.RtExpires,
+		},
+		Version:  claims.Version,
+		FamilyID: td.FamilyID,
+		ClientID: family.ClientID,
+		AuthTime: td.AuthTime,
 	}
-	rtClaims := jwt.MapClaims{}
-	rtClaims["refresh_uuid"] = td.RefreshUuid
-	rtClaims["user_id"] = userID
-	rtClaims["exp"] = td.RtExpires
 	rt := jwt.NewWithClaims(jwt.SigningMethodHS256, rtClaims)
-	td.RefreshToken, err = rt.SignedString([]byte(os.Getenv("ACCESS_SECRET")))
+	td.RefreshToken, err = rt.SignedString(s.keys.Refresh)
 	if err != nil {
 		return nil, err
 	}
@@ -88,6 +159,40 @@ func (s *TokenService) CreateAuth(userID int, td *model.TokenDetails) error {
 		return errRefresh
 	}
 
+	// the family remembers the current pair, so it can be revoked as a whole
+	familyKey := familyKey(td.FamilyID)
+	familyTokensKey := familyTokensKey(td.FamilyID)
+
+	userSessionsKey := userSessionsKey(userID)
+	userTokensKey := userTokensKey(userID)
+
+	_, errFamily := s.redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HMSet(familyKey, map[string]interface{}{
+			"user_id":      userID,
+			"access_uuid":  td.AccessUuid,
+			"refresh_uuid": td.RefreshUuid,
+			"last_used":    now.Unix(),
+		})
+		pipe.Expire(familyKey, rt.Sub(now))
+		// the refresh token outlives every access token of the family, so the
+		// set lives as long as the family
+		pipe.SAdd(familyTokensKey, td.AccessUuid, td.RefreshUuid)
+		pipe.Expire(familyTokensKey, rt.Sub(now))
+		// sessions of different clients expire at different times, the indexes
+		// live as long as the longest possible session and are pruned lazily
+		pipe.SAdd(userSessionsKey, td.FamilyID)
+		pipe.Expire(userSessionsKey, s.maxSessionAge)
+		// rotated access tokens stay valid until they expire, so the user index
+		// keeps every uuid, not only the current pair of each session
+		pipe.SAdd(userTokensKey, td.AccessUuid, td.RefreshUuid)
+		pipe.Expire(userTokensKey, s.maxSessionAge)
+		return nil
+	})
+	if errFamily != nil {
+		s.logger.Error(errFamily)
+		return errFamily
+	}
+
 	return nil
 }
 
@@ -100,3 +205,136 @@ func (s *TokenService) DeleteAuth(giveUuid string) (int64, error) {
 
 	return deleted, nil
 }
+
+func (s *TokenService) JWKS() (*jwk.JWKS, error) {
+	return s.keys.Access.JWKS()
+}
+
+func (s *TokenService) RotateKeys() (*jwk.JWKS, error) {
+
+	key, err := s.keys.Access.Rotate()
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+
+	s.logger.Infof("signing key rotated, new active key %s", key.ID)
+
+	return s.keys.Access.JWKS()
+}
+
+func (s *TokenService) ReloadKeys() error {
+	return s.keys.Access.Reload()
+}
+
+func (s *TokenService) VerifyAccessToken(tokenString string) (*model.AccessDetails, error) {
+
+	var accessClaims claims.Access
+
+	err := s.parseToken(tokenString, &accessClaims, func(token *jwt.Token) (interface{}, error) {
+		key := s.keys.Access.Active()
+		if kid, ok := token.Header["kid"].(string); ok {
+			key, ok = s.keys.Access.Lookup(kid)
+			if !ok {
+				return nil, fmt.Errorf("unknown key id: %s", kid)
+			}
+		}
+		// the alg header is attacker controlled, it must match the selected key
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.PublicKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = claims.VerifyFor(&accessClaims.StandardClaims, s.issuer, s.audiences)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenInvalid, err)
+	}
+
+	accessDetails, err := model.NewAccessDetails(&accessClaims)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenInvalid, err)
+	}
+
+	// a signed out token is still signed, only the store knows it is gone
+	exists, err := s.redis.Exists(accessDetails.AccessUuid).Result()
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, ErrTokenRevoked
+	}
+
+	return accessDetails, nil
+}
+
+func (s *TokenService) VerifyRefreshToken(tokenString string) (*model.RefreshDetails, error) {
+
+	var refreshClaims claims.Refresh
+
+	err := s.parseToken(tokenString, &refreshClaims, func(token *jwt.Token) (interface{}, error) {
+		// Make sure that the token method confirm to "SigningMethodHMAC"
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return s.keys.Refresh, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = claims.VerifyFor(&refreshClaims.StandardClaims, s.issuer, []string{s.issuer})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenInvalid, err)
+	}
+
+	refreshDetails, err := model.NewRefreshDetails(&refreshClaims)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenInvalid, err)
+	}
+
+	return refreshDetails, nil
+}
+
+func (s *TokenService) parseToken(tokenString string, claims jwt.Claims, keyFunc jwt.Keyfunc) error {
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, keyFunc)
+
+	var validationErr *jwt.ValidationError
+	if errors.As(err, &validationErr) && validationErr.Errors == jwt.ValidationErrorExpired {
+		return ErrTokenExpired
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTokenInvalid, err)
+	}
+
+	if !token.Valid {
+		return fmt.Errorf("%w: token is not valid", ErrTokenInvalid)
+	}
+
+	return nil
+}
+
+// audienceFor maps the client of a sign-in to the audience of its access
+// tokens, sign-ins without a client get the default audience.
+func (s *TokenService) audienceFor(clientID string) (string, error) {
+
+	if clientID == "" {
+		return s.defaultAudience, nil
+	}
+
+	client, ok := s.clients[clientID]
+	if !ok {
+		return "", ErrUnknownClient
+	}
+
+	if client.Audience == "" {
+		return s.defaultAudience, nil
+	}
+
+	return client.Audience, nil
+}
@@ -1,26 +1,73 @@
 package service
 
 import (
-	"golang.org/x/crypto/bcrypt"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+	"user/config"
 	"user/internal/logging"
 	"user/internal/model"
+	"user/internal/password"
 	"user/internal/repository"
+	"user/internal/validation"
 )
 
+const SubjectPasswordChanged = "user.password.changed"
+
 type UserService struct {
-	rep    *repository.Repository
-	logger *logging.Logger
+	rep       *repository.Repository
+	logger    *logging.Logger
+	tokens    Token
+	policy    *password.Policy
+	hashers   *password.Hashers
+	publisher Publisher
+	emailCfg  config.EmailCfg
+
+	dummy     string
+	dummyOnce sync.Once
 }
 
-func NewUserService(rep *repository.Repository, log *logging.Logger) *UserService {
+func NewUserService(rep *repository.Repository, log *logging.Logger, tokens Token, policy *password.Policy, hashers *password.Hashers, publisher Publisher, emailCfg config.EmailCfg) *UserService {
 	return &UserService{
-		rep:    rep,
-		logger: log,
+		rep:       rep,
+		logger:    log,
+		tokens:    tokens,
+		policy:    policy,
+		hashers:   hashers,
+		publisher: publisher,
+		emailCfg:  emailCfg,
 	}
 }
 
 func (s *UserService) CreateUser(u *model.User) (int, error) {
 
+	err := s.policy.Check(u.Name, u.Password)
+	if err != nil {
+		return 0, err
+	}
+
+	exists, err := s.rep.ExistsUser(u.Name)
+	if err != nil {
+		s.logger.Error(err)
+		return 0, err
+	}
+	if exists {
+		return 0, ErrUserExists
+	}
+
+	if u.Email != "" {
+		exists, err = s.rep.ExistsEmail(u.Email)
+		if err != nil {
+			s.logger.Error(err)
+			return 0, err
+		}
+		if exists {
+			return 0, ErrEmailExists
+		}
+	}
+
 	hash, err := s.GenerateHash(u.Password)
 	if err != nil {
 		s.logger.Error(err)
@@ -30,6 +77,13 @@ func (s *UserService) CreateUser(u *model.User) (int, error) {
 	u.Password = hash
 
 	userID, err := s.rep.CreateUser(u)
+	if errors.Is(err, repository.ErrEmailTaken) {
+		return 0, ErrEmailExists
+	}
+	// the check above is only a shortcut, this is the one that holds under races
+	if errors.Is(err, repository.ErrNameTaken) {
+		return 0, ErrUserExists
+	}
 	if err != nil {
 		s.logger.Error(err)
 		return 0, err
@@ -38,25 +92,273 @@ func (s *UserService) CreateUser(u *model.User) (int, error) {
 	return userID, nil
 }
 
+// GetUser checks the credentials and returns the id of the stored user, the
+// name may be a username or an email address. An unknown name and a wrong
+// password give the same error in the same time.
 func (s *UserService) GetUser(u *model.User) (int, error) {
 
-	user, err := s.rep.GetUser(u)
+	user, err := s.findUser(u.Name)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		// burn the time of a real comparison so callers can't enumerate users
+		_, _, _ = s.hashers.Verify(s.dummyHash(), u.Password)
+		return 0, ErrInvalidCredentials
+	}
 	if err != nil {
 		s.logger.Error(err)
 		return 0, err
 	}
 
-	err = s.CompareHashPassword(user.Password, u.Password)
+	ok, rehash, err := s.hashers.Verify(user.Password, u.Password)
 	if err != nil {
 		s.logger.Error(err)
 		return 0, err
 	}
+	if !ok {
+		return 0, ErrInvalidCredentials
+	}
+
+	if rehash {
+		s.rehash(user, u.Password)
+	}
+
+	// only tell after the password was right, or this would leak addresses
+	if s.emailCfg.RequireVerified && user.EmailVerifiedAt == nil {
+		return 0, ErrEmailNotVerified
+	}
+
+	return user.ID, nil
+}
+
+// findUser looks a user up by username or, if it has an @, by email address.
+// The default username pattern allows no @, so the two can't clash.
+func (s *UserService) findUser(name string) (*model.User, error) {
+	if strings.Contains(name, "@") {
+		return s.rep.GetUserByEmail(name)
+	}
+	return s.rep.GetUser(&model.User{Name: name})
+}
+
+// rehash moves the user to the current hash algorithm and parameters. It only
+// runs after a successful sign-in, a failure is logged and retried next time.
+func (s *UserService) rehash(user *model.User, plain string) {
+
+	hash, err := s.hashers.Hash(plain)
+	if err != nil {
+		s.logger.Errorf("cannot rehash password of user %d: %v", user.ID, err)
+		return
+	}
+
+	updated, err := s.rep.UpdatePasswordHash(user.ID, user.Password, hash)
+	if err != nil {
+		s.logger.Errorf("cannot rehash password of user %d: %v", user.ID, err)
+		return
+	}
+
+	if updated {
+		s.logger.Infof("password hash of user %d upgraded", user.ID)
+	}
+}
 
-	return u.ID, nil
+func (s *UserService) dummyHash() string {
+	s.dummyOnce.Do(func() {
+		s.dummy, _ = s.hashers.Hash("dummy password")
+	})
+	return s.dummy
 }
 
+// SignOut revokes every access and refresh token of the user
 func (s *UserService) SignOut(userID int) error {
-	return nil // TODO
+
+	err := s.tokens.RevokeUserTokens(userID)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	s.logger.Infof("user %d signed out everywhere", userID)
+
+	return nil
+}
+
+// ChangePassword replaces the password of a signed in user who knows the
+// current one. Every other session ends, the one in sessionID stays signed in.
+func (s *UserService) ChangePassword(userID int, sessionID string, change *model.PasswordChange) error {
+
+	user, err := s.rep.GetUserByID(userID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return ErrTokenRevoked
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	err = s.verifyPassword(user, change.CurrentPassword)
+	if err != nil {
+		return err
+	}
+
+	if change.Password == change.CurrentPassword {
+		return validation.Errors{{Field: "password", Message: "must differ from the current password"}}
+	}
+
+	hash, err := s.newPasswordHash(user, change.Password)
+	if err != nil {
+		return err
+	}
+
+	changed, err := s.rep.ChangePassword(userID, user.Password, hash)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	if !changed {
+		return ErrPasswordConflict
+	}
+
+	s.logger.Infof("password of user %d changed", userID)
+
+	// whoever else knew the old password is signed out now
+	err = s.tokens.RevokeOtherSessions(userID, sessionID)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	s.publishPasswordChanged(userID, "change")
+
+	return nil
+}
+
+// verifyPassword confirms a signed in user knows their password before a
+// sensitive change
+func (s *UserService) verifyPassword(user *model.User, password string) error {
+
+	ok, _, err := s.hashers.Verify(user.Password, password)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	if !ok {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+func (s *UserService) verifyCurrentPassword(userID int, password string) error {
+
+	if password == "" {
+		return validation.Errors{{Field: "current_password", Message: "is required to change the email address"}}
+	}
+
+	user, err := s.rep.GetUserByID(userID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return ErrTokenRevoked
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	return s.verifyPassword(user, password)
+}
+
+// newPasswordHash applies the password policy and hashes a new password
+func (s *UserService) newPasswordHash(user *model.User, password string) (string, error) {
+
+	err := s.policy.Check(user.Name, password)
+	if err != nil {
+		return "", err
+	}
+
+	return s.GenerateHash(password)
+}
+
+func (s *UserService) publishPasswordChanged(userID int, reason string) {
+
+	eventBytes, err := json.Marshal(model.PasswordChangedEvent{
+		UserID:    userID,
+		Reason:    reason,
+		ChangedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		s.logger.Error(err)
+		return
+	}
+
+	err = s.publisher.Publish(SubjectPasswordChanged, eventBytes)
+	if err != nil {
+		s.logger.Error(err)
+	}
+}
+
+func (s *UserService) GetProfile(userID int) (*model.Profile, error) {
+
+	profile, err := s.rep.GetProfile(userID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil, ErrTokenRevoked
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+// UpdateProfile applies the update to the version of the profile it was read
+// from. If anyone changed the profile since, nothing is written and the caller
+// gets ErrProfileConflict: they have to read it again and redo their edit.
+func (s *UserService) UpdateProfile(userID int, update *model.ProfileUpdate) (*model.Profile, error) {
+
+	profile, err := s.GetProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !profile.Updated.Equal(update.Updated) {
+		return nil, ErrProfileConflict
+	}
+
+	// the address receives password resets, a stolen access token alone must
+	// not be enough to redirect them
+	if update.Email != nil && !strings.EqualFold(*update.Email, profile.Email) {
+		err = s.verifyCurrentPassword(userID, update.CurrentPassword)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if update.DisplayName != nil {
+		profile.DisplayName = *update.DisplayName
+	}
+	if update.Email != nil {
+		profile.Email = *update.Email
+	}
+	if update.Locale != nil {
+		profile.Locale = *update.Locale
+	}
+	if update.Timezone != nil {
+		profile.Timezone = *update.Timezone
+	}
+
+	// the check above is only a shortcut, this is the one that holds under races
+	updated, err := s.rep.UpdateProfile(profile, update.Updated)
+	if errors.Is(err, repository.ErrEmailTaken) {
+		return nil, ErrEmailExists
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+	if !updated {
+		return nil, ErrProfileConflict
+	}
+
+	s.logger.Infof("profile of user %d updated", userID)
+
+	return profile, nil
 }
 
 func (s *UserService) ExistsUser(userName string) (bool, error) {
@@ -65,22 +367,25 @@ func (s *UserService) ExistsUser(userName string) (bool, error) {
 
 func (s *UserService) GenerateHash(password string) (string, error) {
 
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hash, err := s.hashers.Hash(password)
 	if err != nil {
 		s.logger.Errorf("cannot generating password with error: %s", err.Error())
 		return "", err
 	}
 
-	return string(bytes), nil
+	return hash, nil
 }
 
 func (s *UserService) CompareHashPassword(passFromDb, passFromUser string) error {
 
-	err := bcrypt.CompareHashAndPassword([]byte(passFromDb), []byte(passFromUser))
+	ok, _, err := s.hashers.Verify(passFromDb, passFromUser)
 	if err != nil {
-		s.logger.Errorf("mismatched password: %s", passFromUser)
+		s.logger.Error(err)
 		return err
 	}
+	if !ok {
+		return ErrInvalidCredentials
+	}
 
 	return nil
 }
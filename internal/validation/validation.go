@@ -0,0 +1,337 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+	// time zones resolve without zoneinfo installed on the host
+	_ "time/tzdata"
+	"unicode"
+	"unicode/utf8"
+	"user/config"
+	"user/internal/model"
+)
+
+var ErrPayloadTooLarge = errors.New("payload too large")
+
+// a BCP 47 language tag such as "en", "pt-BR" or "zh-Hant-TW"
+var localePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors collects every problem of a payload, so the caller can fix them all
+// at once.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+
+	messages := make([]string, 0, len(e))
+	for _, fieldErr := range e {
+		messages = append(messages, fieldErr.Field+": "+fieldErr.Message)
+	}
+
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+func (e *Errors) add(field, format string, args ...interface{}) {
+	*e = append(*e, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (e Errors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+type Validator struct {
+	cfg      config.ValidationCfg
+	username *regexp.Regexp
+}
+
+func NewValidator(cfg config.ValidationCfg) (*Validator, error) {
+
+	username, err := regexp.Compile(cfg.UsernamePattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid username_pattern: %w", err)
+	}
+
+	return &Validator{
+		cfg:      cfg,
+		username: username,
+	}, nil
+}
+
+// Payload refuses oversized requests before they are decoded.
+func (v *Validator) Payload(data []byte) error {
+	if v.cfg.MaxPayloadSize > 0 && len(data) > v.cfg.MaxPayloadSize {
+		return fmt.Errorf("%w: %d bytes, at most %d allowed", ErrPayloadTooLarge, len(data), v.cfg.MaxPayloadSize)
+	}
+	return nil
+}
+
+// SignUp applies every rule to the new credentials.
+func (v *Validator) SignUp(u *model.User) error {
+
+	var errs Errors
+
+	if u == nil {
+		u = &model.User{}
+	}
+
+	if v.checkName(&errs, u.Name) {
+		switch {
+		case utf8.RuneCountInString(u.Name) < v.cfg.UsernameMinLength:
+			errs.add("name", "must be at least %d characters", v.cfg.UsernameMinLength)
+		case !v.username.MatchString(u.Name):
+			errs.add("name", "contains characters that are not allowed")
+		}
+	}
+
+	// the strength of the password is up to the password policy
+	v.checkPassword(&errs, "password", u.Password)
+
+	// the address is optional at sign-up
+	if u.Email != "" {
+		v.checkEmail(&errs, u.Email)
+	}
+
+	return errs.err()
+}
+
+// SignIn only checks the shape of the credentials: accounts created under
+// older rules must still be able to sign in. The name may be an email address.
+func (v *Validator) SignIn(u *model.User) error {
+
+	var errs Errors
+
+	if u == nil {
+		u = &model.User{}
+	}
+
+	v.checkLogin(&errs, u.Name)
+	v.checkPassword(&errs, "password", u.Password)
+
+	return errs.err()
+}
+
+// PasswordChange checks the shape of both passwords, the new one still has to
+// pass the password policy.
+func (v *Validator) PasswordChange(p *model.PasswordChange) error {
+
+	var errs Errors
+
+	if p == nil {
+		p = &model.PasswordChange{}
+	}
+
+	v.checkPassword(&errs, "current_password", p.CurrentPassword)
+	v.checkPassword(&errs, "password", p.Password)
+
+	return errs.err()
+}
+
+func (v *Validator) PasswordResetRequest(r *model.PasswordResetRequest) error {
+
+	var errs Errors
+
+	if r == nil {
+		r = &model.PasswordResetRequest{}
+	}
+
+	v.checkLogin(&errs, r.Name)
+
+	return errs.err()
+}
+
+func (v *Validator) EmailVerificationRequest(r *model.EmailVerificationRequest) error {
+
+	var errs Errors
+
+	if r == nil {
+		r = &model.EmailVerificationRequest{}
+	}
+
+	v.checkLogin(&errs, r.Name)
+
+	return errs.err()
+}
+
+func (v *Validator) EmailVerificationConfirm(r *model.EmailVerificationConfirm) error {
+
+	var errs Errors
+
+	if r == nil || r.Token == "" {
+		errs.add("token", "is required")
+	}
+
+	return errs.err()
+}
+
+func (v *Validator) PasswordResetConfirm(r *model.PasswordResetConfirm) error {
+
+	var errs Errors
+
+	if r == nil {
+		r = &model.PasswordResetConfirm{}
+	}
+
+	if r.Token == "" {
+		errs.add("token", "is required")
+	}
+	v.checkPassword(&errs, "password", r.Password)
+
+	return errs.err()
+}
+
+func (v *Validator) AccountDeletion(a *model.AccountDeletion) error {
+
+	var errs Errors
+
+	if a == nil {
+		a = &model.AccountDeletion{}
+	}
+
+	v.checkPassword(&errs, "password", a.Password)
+
+	return errs.err()
+}
+
+func (v *Validator) AccountRestore(a *model.AccountRestore) error {
+
+	var errs Errors
+
+	if a == nil {
+		a = &model.AccountRestore{}
+	}
+
+	v.checkName(&errs, a.Name)
+	v.checkPassword(&errs, "password", a.Password)
+
+	return errs.err()
+}
+
+// Profile checks the fields an update sets, those left out stay as they are.
+// An empty string clears a field and is always valid.
+func (v *Validator) Profile(p *model.ProfileUpdate) error {
+
+	var errs Errors
+
+	if p == nil {
+		p = &model.ProfileUpdate{}
+	}
+
+	if p.Updated.IsZero() {
+		errs.add("updated", "is required, send the value of the profile being edited")
+	}
+
+	if p.DisplayName != nil && v.checkText(&errs, "display_name", *p.DisplayName) {
+		if utf8.RuneCountInString(*p.DisplayName) > v.cfg.DisplayNameMaxLength {
+			errs.add("display_name", "must be at most %d characters", v.cfg.DisplayNameMaxLength)
+		}
+	}
+
+	if p.Email != nil && *p.Email != "" {
+		v.checkEmail(&errs, *p.Email)
+	}
+
+	if p.CurrentPassword != "" {
+		v.checkPassword(&errs, "current_password", p.CurrentPassword)
+	}
+
+	if p.Locale != nil && *p.Locale != "" && !localePattern.MatchString(*p.Locale) {
+		errs.add("locale", "must be a language tag such as en or pt-BR")
+	}
+
+	if p.Timezone != nil && *p.Timezone != "" {
+		// Local would be the zone of this server
+		_, err := time.LoadLocation(*p.Timezone)
+		if err != nil || *p.Timezone == "Local" {
+			errs.add("timezone", "must be an IANA time zone such as Europe/Berlin")
+		}
+	}
+
+	return errs.err()
+}
+
+func (v *Validator) checkEmail(errs *Errors, email string) bool {
+
+	if !v.checkText(errs, "email", email) {
+		return false
+	}
+
+	address, err := mail.ParseAddress(email)
+	switch {
+	case utf8.RuneCountInString(email) > v.cfg.EmailMaxLength:
+		errs.add("email", "must be at most %d characters", v.cfg.EmailMaxLength)
+	case err != nil || address.Name != "" || address.Address != email:
+		errs.add("email", "is not a valid email address")
+	default:
+		return true
+	}
+	return false
+}
+
+// checkLogin takes a username or an email address, errors are reported on the
+// name field either way.
+func (v *Validator) checkLogin(errs *Errors, name string) bool {
+
+	if !strings.Contains(name, "@") {
+		return v.checkName(errs, name)
+	}
+
+	switch {
+	case !utf8.ValidString(name) || strings.IndexFunc(name, unicode.IsControl) >= 0:
+		errs.add("name", "contains control or invalid characters")
+	case utf8.RuneCountInString(name) > v.cfg.EmailMaxLength:
+		errs.add("name", "must be at most %d characters", v.cfg.EmailMaxLength)
+	default:
+		return true
+	}
+	return false
+}
+
+// checkText refuses the characters no profile field may hold
+func (v *Validator) checkText(errs *Errors, field, value string) bool {
+	if !utf8.ValidString(value) || strings.IndexFunc(value, unicode.IsControl) >= 0 {
+		errs.add(field, "contains control or invalid characters")
+		return false
+	}
+	return true
+}
+
+// checkName and checkPassword apply the rules shared by sign-up and sign-in,
+// they report whether the field passed.
+func (v *Validator) checkName(errs *Errors, name string) bool {
+	switch {
+	case name == "":
+		errs.add("name", "is required")
+	case !utf8.ValidString(name) || strings.IndexFunc(name, unicode.IsControl) >= 0:
+		errs.add("name", "contains control or invalid characters")
+	case utf8.RuneCountInString(name) > v.cfg.UsernameMaxLength:
+		errs.add("name", "must be at most %d characters", v.cfg.UsernameMaxLength)
+	default:
+		return true
+	}
+	return false
+}
+
+func (v *Validator) checkPassword(errs *Errors, field, password string) bool {
+	switch {
+	case password == "":
+		errs.add(field, "is required")
+	case !utf8.ValidString(password) || strings.IndexFunc(password, unicode.IsControl) >= 0:
+		errs.add(field, "contains control or invalid characters")
+	case len(password) > v.cfg.PasswordMaxLength:
+		errs.add(field, "must be at most %d bytes", v.cfg.PasswordMaxLength)
+	default:
+		return true
+	}
+	return false
+}
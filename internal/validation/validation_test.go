@@ -0,0 +1,170 @@
+package validation
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"user/config"
+	"user/internal/model"
+)
+
+func newTestValidator(t *testing.T) *Validator {
+
+	v, err := NewValidator(config.ValidationCfg{
+		MaxPayloadSize:       64,
+		UsernameMinLength:    3,
+		UsernameMaxLength:    8,
+		UsernamePattern:      "^[a-z0-9._-]+$",
+		PasswordMaxLength:    16,
+		DisplayNameMaxLength: 10,
+		EmailMaxLength:       20,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return v
+}
+
+// fields lists the fields an error complains about, in order
+func fields(t *testing.T, err error) []string {
+
+	if err == nil {
+		return nil
+	}
+
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("error %v is not Errors", err)
+	}
+
+	var names []string
+	for _, fieldErr := range errs {
+		names = append(names, fieldErr.Field)
+	}
+
+	return names
+}
+
+func TestSignUp(t *testing.T) {
+
+	v := newTestValidator(t)
+
+	tests := []struct {
+		name string
+		user *model.User
+		want []string
+	}{
+		{"valid", &model.User{Name: "alice", Password: "pw"}, nil},
+		{"valid with email", &model.User{Name: "alice", Password: "pw", Email: "a@example.com"}, nil},
+		{"null payload", nil, []string{"name", "password"}},
+		{"empty", &model.User{}, []string{"name", "password"}},
+		{"name too short", &model.User{Name: "al", Password: "pw"}, []string{"name"}},
+		{"name too long", &model.User{Name: "alice-and-bob", Password: "pw"}, []string{"name"}},
+		{"name pattern", &model.User{Name: "Alice", Password: "pw"}, []string{"name"}},
+		{"name control character", &model.User{Name: "ali\nce", Password: "pw"}, []string{"name"}},
+		{"name invalid UTF-8", &model.User{Name: "ali\xffce", Password: "pw"}, []string{"name"}},
+		{"password too long", &model.User{Name: "alice", Password: strings.Repeat("x", 17)}, []string{"password"}},
+		{"password control character", &model.User{Name: "alice", Password: "p\x00w"}, []string{"password"}},
+		{"email with display name", &model.User{Name: "alice", Password: "pw", Email: "Alice <a@example.com>"}, []string{"email"}},
+		{"email too long", &model.User{Name: "alice", Password: "pw", Email: "alice@a-long-domain.example"}, []string{"email"}},
+		{"email malformed", &model.User{Name: "alice", Password: "pw", Email: "alice"}, []string{"email"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fields(t, v.SignUp(tt.user))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SignUp() fields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignIn(t *testing.T) {
+
+	v := newTestValidator(t)
+
+	tests := []struct {
+		name string
+		user *model.User
+		want []string
+	}{
+		{"valid", &model.User{Name: "alice", Password: "pw"}, nil},
+		// accounts made under older rules still sign in
+		{"name outside the pattern", &model.User{Name: "Al", Password: "pw"}, nil},
+		{"email", &model.User{Name: "a@example.com", Password: "pw"}, nil},
+		{"email too long", &model.User{Name: "alice@a-long-domain.example", Password: "pw"}, []string{"name"}},
+		{"email control character", &model.User{Name: "a@exa\tmple.com", Password: "pw"}, []string{"name"}},
+		{"null payload", nil, []string{"name", "password"}},
+		{"name too long", &model.User{Name: "alice-and-bob", Password: "pw"}, []string{"name"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fields(t, v.SignIn(tt.user))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SignIn() fields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProfile(t *testing.T) {
+
+	v := newTestValidator(t)
+
+	text := func(s string) *string { return &s }
+	updated := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		update *model.ProfileUpdate
+		want   []string
+	}{
+		{"nothing set", &model.ProfileUpdate{Updated: updated}, nil},
+		{"every field", &model.ProfileUpdate{Updated: updated, DisplayName: text("Alice"), Email: text("a@example.com"), Locale: text("pt-BR"), Timezone: text("Europe/Berlin")}, nil},
+		{"clearing fields", &model.ProfileUpdate{Updated: updated, DisplayName: text(""), Email: text(""), Locale: text(""), Timezone: text("")}, nil},
+		{"null payload", nil, []string{"updated"}},
+		{"missing version", &model.ProfileUpdate{}, []string{"updated"}},
+		{"display name too long", &model.ProfileUpdate{Updated: updated, DisplayName: text("Alice Liddell")}, []string{"display_name"}},
+		{"display name control character", &model.ProfileUpdate{Updated: updated, DisplayName: text("Al\x1bice")}, []string{"display_name"}},
+		{"locale", &model.ProfileUpdate{Updated: updated, Locale: text("english")}, []string{"locale"}},
+		{"unknown time zone", &model.ProfileUpdate{Updated: updated, Timezone: text("Mars/Olympus")}, []string{"timezone"}},
+		{"server time zone", &model.ProfileUpdate{Updated: updated, Timezone: text("Local")}, []string{"timezone"}},
+		{"email", &model.ProfileUpdate{Updated: updated, Email: text("a@")}, []string{"email"}},
+		{"current password control character", &model.ProfileUpdate{Updated: updated, Email: text("a@example.com"), CurrentPassword: "p\x00w"}, []string{"current_password"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fields(t, v.Profile(tt.update))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Profile() fields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPayload(t *testing.T) {
+
+	v := newTestValidator(t)
+
+	if err := v.Payload(make([]byte, 64)); err != nil {
+		t.Errorf("Payload() of 64 bytes = %v", err)
+	}
+
+	if err := v.Payload(make([]byte, 65)); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Errorf("Payload() of 65 bytes = %v, want ErrPayloadTooLarge", err)
+	}
+}
+
+func TestNewValidatorRejectsPattern(t *testing.T) {
+
+	_, err := NewValidator(config.ValidationCfg{UsernamePattern: "("})
+	if err == nil {
+		t.Error("NewValidator() accepted an invalid username pattern")
+	}
+}
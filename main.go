@@ -2,17 +2,25 @@ package main
 
 import (
 	"context"
-	"github.com/jackc/pgx/v5"
+	"encoding/json"
+	"errors"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/nats-io/nats.go"
 	"net"
 	"os"
+	"time"
 	"user/config"
 	"user/internal/db"
 	"user/internal/handler"
+	"user/internal/keys"
 	"user/internal/logging"
+	"user/internal/mfa"
+	"user/internal/password"
+	"user/internal/ratelimit"
 	"user/internal/redis"
 	"user/internal/repository"
 	"user/internal/service"
+	"user/internal/validation"
 )
 
 func main() {
@@ -20,6 +28,44 @@ func main() {
 
 	cfg := config.GetConfig()
 
+	if len(os.Args) > 1 && os.Args[1] == "rotate-keys" {
+		rotateKeys(cfg)
+		return
+	}
+
+	err := cfg.TokenCfg.Validate()
+	if err != nil {
+		log.Fatalf("invalid token configuration: %v", err)
+	}
+
+	signingKeys, err := keys.Load(cfg.TokenCfg)
+	if err != nil {
+		log.Fatalf("invalid signing keys: %v", err)
+	}
+
+	validator, err := validation.NewValidator(cfg.ValidationCfg)
+	if err != nil {
+		log.Fatalf("invalid validation configuration: %v", err)
+	}
+
+	policy, err := password.NewPolicy(cfg.PasswordCfg)
+	if err != nil {
+		log.Fatalf("cannot load password policy: %v", err)
+	}
+	log.Infof("password policy loaded with %d breached passwords", policy.BreachedCount())
+
+	hashers, err := password.NewHashers(cfg.PasswordCfg)
+	if err != nil {
+		log.Fatalf("invalid password hashing configuration: %v", err)
+	}
+
+	mfaCipher, err := mfa.LoadCipher(cfg.MFACfg)
+	if errors.Is(err, mfa.ErrNoEncryptionKey) {
+		log.Warn("mfa is disabled, no encryption key is configured")
+	} else if err != nil {
+		log.Fatalf("invalid mfa configuration: %v", err)
+	}
+
 	nc, err := nats.Connect(net.JoinHostPort(cfg.BrokerCfg.Host, cfg.BrokerCfg.Port), nats.Name("user service"))
 	if err != nil {
 		log.Fatal(err)
@@ -34,36 +80,162 @@ func main() {
 	if err != nil {
 		log.Println(err)
 	}
-	defer pgxConn.Close(context.Background())
+	defer pgxConn.Close()
 
 	migrate(pgxConn)
 
 	newRepository := repository.NewRepository(pgxConn, log)
 
-	newService := service.NewService(newRepository, log, redisClient)
+	newService := service.NewService(newRepository, log, redisClient, signingKeys, cfg, nc, policy, hashers, mfaCipher)
+
+	go purgeAccounts(newService, cfg.AccountCfg.PurgeInterval)
 
-	newHandler := handler.NewHandler(nc, log, newService)
+	newHandler := handler.NewHandler(nc, log, newService, cfg, validator, ratelimit.NewLimiter(redisClient, cfg.RateLimitCfg))
 	newHandler.Init()
 
 }
 
-func migrate(pgxConn *pgx.Conn) {
+// migrations run in this order, each one once. inits.sql predates the
+// bookkeeping and counts as applied when the users table exists.
+var migrations = []string{
+	"inits.sql",
+	"mfa.sql",
+	"recovery_codes.sql",
+	"profile.sql",
+	"email.sql",
+	"deletion.sql",
+}
+
+func migrate(pgxConn *pgxpool.Pool) {
 
-	var exists bool
+	log := logging.GetLogger()
+	ctx := context.Background()
 
-	migrateBytes, err := os.ReadFile("./pkg/schemas/inits.sql")
+	_, err := pgxConn.Exec(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (name text primary key, applied timestamptz default current_timestamp)")
 	if err != nil {
-		logging.GetLogger().Fatal(err)
+		log.Fatal(err)
 	}
 
-	err = pgxConn.QueryRow(context.Background(), "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", "users").Scan(&exists)
+	var usersExist bool
+
+	err = pgxConn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", "users").Scan(&usersExist)
 	if err != nil {
-		logging.GetLogger().Fatal(err)
+		log.Fatal(err)
 	}
-	if !exists {
-		_, err := pgxConn.Exec(context.Background(), string(migrateBytes))
+
+	for _, name := range migrations {
+
+		var applied bool
+
+		err = pgxConn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE name = $1)", name).Scan(&applied)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if applied {
+			continue
+		}
+
+		migrateBytes, err := os.ReadFile("./pkg/schemas/" + name)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		tx, err := pgxConn.Begin(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if name != "inits.sql" || !usersExist {
+			_, err = tx.Exec(ctx, string(migrateBytes))
+			if err != nil {
+				tx.Rollback(ctx)
+				log.Fatalf("migration %s failed: %v", name, err)
+			}
+		}
+
+		_, err = tx.Exec(ctx, "INSERT INTO schema_migrations (name) VALUES ($1)", name)
+		if err != nil {
+			tx.Rollback(ctx)
+			log.Fatal(err)
+		}
+
+		err = tx.Commit(ctx)
 		if err != nil {
-			logging.GetLogger().Fatal(err)
+			log.Fatal(err)
 		}
+
+		log.Infof("migration %s applied", name)
+	}
+}
+
+// purgeAccounts removes deleted accounts past their grace period, now and then
+// every interval. An interval of 0 turns purging off.
+func purgeAccounts(s *service.Service, interval time.Duration) {
+
+	log := logging.GetLogger()
+
+	if interval <= 0 {
+		log.Warn("purge_interval is 0, deleted accounts are never purged")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.PurgeDeletedAccounts()
+		if err != nil {
+			log.Errorf("purging deleted accounts failed: %v", err)
+		} else if purged > 0 {
+			log.Infof("%d deleted accounts purged", purged)
+		}
+
+		<-ticker.C
+	}
+}
+
+func rotateKeys(cfg *config.Config) {
+
+	log := logging.GetLogger()
+
+	keyring, err := keys.OpenKeyring(cfg.TokenCfg.KeyringDir, cfg.TokenCfg.SigningAlgorithm, cfg.TokenCfg.PrivateKeyFile, cfg.TokenCfg.RetiredKeyTTL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	key, err := keyring.Rotate()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Infof("signing key rotated, new active key %s", key.ID)
+
+	jwks, err := keyring.JWKS()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	jwksBytes, err := json.Marshal(jwks)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// running instances reload the keyring when they see the new key set
+	nc, err := nats.Connect(net.JoinHostPort(cfg.BrokerCfg.Host, cfg.BrokerCfg.Port), nats.Name("user service key rotation"))
+	if err != nil {
+		log.Warnf("key set not published, restart the service to pick up the new key: %v", err)
+		return
+	}
+	defer nc.Close()
+
+	err = nc.Publish("user.jwks.updated", jwksBytes)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	err = nc.Flush()
+	if err != nil {
+		log.Error(err)
 	}
 }
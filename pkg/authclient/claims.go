@@ -0,0 +1,57 @@
+package authclient
+
+import (
+	"user/pkg/claims"
+)
+
+// Claims are the verified claims of an access token
+type Claims struct {
+	AccessUuid string `json:"access_uuid"`
+	SessionID  string `json:"session_id"`
+	UserId     int    `json:"user_id"`
+	ClientID   string `json:"client_id"`
+	Scope      string `json:"scope"`
+	Issuer     string `json:"iss"`
+	Audience   string `json:"aud"`
+	AuthTime   int64  `json:"auth_time"`
+	IssuedAt   int64  `json:"iat"`
+	NotBefore  int64  `json:"nbf"`
+	ExpiresAt  int64  `json:"exp"`
+}
+
+func newClaims(c *claims.Access) (*Claims, error) {
+
+	userID, err := claims.UserID(&c.StandardClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Claims{
+		AccessUuid: c.Id,
+		SessionID:  c.SessionID,
+		UserId:     userID,
+		ClientID:   c.ClientID,
+		Scope:      c.Scope,
+		Issuer:     c.Issuer,
+		Audience:   c.Audience,
+		AuthTime:   c.AuthTime,
+		IssuedAt:   c.IssuedAt,
+		NotBefore:  c.NotBefore,
+		ExpiresAt:  c.ExpiresAt,
+	}, nil
+}
+
+// the messages exchanged with the user service, only the fields the client
+// reads are declared
+type introspectionRequest struct {
+	Token         string `json:"token"`
+	TokenTypeHint string `json:"token_type_hint"`
+}
+
+type introspection struct {
+	Active bool `json:"active"`
+}
+
+type revocationEvent struct {
+	Uuids []string `json:"uuids"`
+}
@@ -0,0 +1,249 @@
+// Package authclient verifies access tokens issued by the user service without
+// a round trip per request: signatures are checked against the published
+// JWKS, revocation is optionally checked through introspection or the
+// revocation stream.
+package authclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/nats-io/nats.go"
+	"sync"
+	"time"
+	"user/pkg/claims"
+	"user/pkg/response"
+)
+
+const (
+	SubjectJWKS          = "user.jwks"
+	SubjectJWKSUpdated   = "user.jwks.updated"
+	SubjectIntrospect    = "user.token.introspect"
+	SubjectTokensRevoked = "user.tokens.revoked"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrRevokedToken = errors.New("token revoked")
+)
+
+type Revocation int
+
+const (
+	// RevocationNone trusts every token until it expires
+	RevocationNone Revocation = iota
+	// RevocationIntrospect asks the user service about every token
+	RevocationIntrospect
+	// RevocationStream follows the revocations pushed by the user service
+	RevocationStream
+)
+
+type Options struct {
+	// Issuer and Audience are required, a token must name this service as
+	// its audience to be accepted
+	Issuer     string
+	Audience   string
+	Revocation Revocation
+	// CacheTTL is how long the key set is used before it is fetched again
+	CacheTTL time.Duration
+	// RefreshInterval throttles refetching the key set for unknown key ids
+	RefreshInterval time.Duration
+	// RevocationRetention must cover the access token lifetime
+	RevocationRetention time.Duration
+	Timeout             time.Duration
+}
+
+func DefaultOptions(audience string) Options {
+	return Options{
+		Issuer:              "user-service",
+		Audience:            audience,
+		Revocation:          RevocationNone,
+		CacheTTL:            time.Hour,
+		RefreshInterval:     30 * time.Second,
+		RevocationRetention: time.Hour,
+		Timeout:             2 * time.Second,
+	}
+}
+
+type Client struct {
+	nats    *nats.Conn
+	options Options
+	jwks    *jwksCache
+	revoked *revocationList
+	subs    []*nats.Subscription
+	fetchMu sync.Mutex
+}
+
+func New(nc *nats.Conn, options Options) (*Client, error) {
+
+	if options.Issuer == "" || options.Audience == "" {
+		return nil, errors.New("issuer and audience are required")
+	}
+
+	c := &Client{
+		nats:    nc,
+		options: options,
+		jwks:    &jwksCache{},
+	}
+
+	err := c.fetchJWKS()
+	if err != nil {
+		return nil, err
+	}
+
+	sub, err := nc.Subscribe(SubjectJWKSUpdated, func(msg *nats.Msg) {
+		_ = c.jwks.store(msg.Data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.subs = append(c.subs, sub)
+
+	if options.Revocation == RevocationStream {
+		c.revoked = newRevocationList(options.RevocationRetention)
+
+		sub, err = nc.Subscribe(SubjectTokensRevoked, func(msg *nats.Msg) {
+			_ = c.revoked.add(msg.Data)
+		})
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.subs = append(c.subs, sub)
+	}
+
+	return c, nil
+}
+
+func (c *Client) Close() {
+	for _, sub := range c.subs {
+		_ = sub.Unsubscribe()
+	}
+}
+
+// Verify checks the signature and expiry of an access token and, depending on
+// the options, whether it has been revoked.
+func (c *Client) Verify(tokenString string) (*Claims, error) {
+
+	if c.jwks.age() > c.options.CacheTTL {
+		// a stale cache is still better than refusing every token
+		_ = c.fetchJWKS()
+	}
+
+	var accessClaims claims.Access
+
+	token, err := jwt.ParseWithClaims(tokenString, &accessClaims, c.keyFunc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	err = claims.VerifyFor(&accessClaims.StandardClaims, c.options.Issuer, []string{c.options.Audience})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	verified, err := newClaims(&accessClaims)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	switch c.options.Revocation {
+	case RevocationStream:
+		if c.revoked.contains(verified.AccessUuid) {
+			return nil, ErrRevokedToken
+		}
+	case RevocationIntrospect:
+		err = c.introspect(tokenString)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return verified, nil
+}
+
+func (c *Client) keyFunc(token *jwt.Token) (interface{}, error) {
+
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		return nil, errors.New("kid header is missing")
+	}
+
+	key, ok := c.jwks.lookup(kid)
+	if !ok {
+		// the key may have been rotated in after the last fetch
+		err := c.fetchJWKS()
+		if err != nil {
+			return nil, err
+		}
+		key, ok = c.jwks.lookup(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown key id: %s", kid)
+		}
+	}
+
+	// the alg header is attacker controlled, it must match the published key
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.key, nil
+}
+
+func (c *Client) fetchJWKS() error {
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+
+	// someone else refreshed while we were waiting for the lock
+	if c.jwks.age() < c.options.RefreshInterval {
+		return nil
+	}
+
+	msg, err := c.nats.Request(SubjectJWKS, nil, c.options.Timeout)
+	if err != nil {
+		return fmt.Errorf("cannot fetch key set: %w", err)
+	}
+
+	var jwks json.RawMessage
+
+	err = response.Decode(msg.Data, &jwks)
+	if err != nil {
+		return fmt.Errorf("cannot fetch key set: %w", err)
+	}
+
+	return c.jwks.store(jwks)
+}
+
+func (c *Client) introspect(tokenString string) error {
+
+	request, err := json.Marshal(introspectionRequest{
+		Token:         tokenString,
+		TokenTypeHint: "access_token",
+	})
+	if err != nil {
+		return err
+	}
+
+	msg, err := c.nats.Request(SubjectIntrospect, request, c.options.Timeout)
+	if err != nil {
+		return fmt.Errorf("cannot introspect token: %w", err)
+	}
+
+	var result introspection
+
+	err = response.Decode(msg.Data, &result)
+	if err != nil {
+		return fmt.Errorf("cannot introspect token: %w", err)
+	}
+
+	if !result.Active {
+		return ErrRevokedToken
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package authclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"sync"
+	"time"
+	"user/pkg/jwk"
+)
+
+type verificationKey struct {
+	method jwt.SigningMethod
+	key    interface{}
+}
+
+// jwksCache keeps the published keys of the user service. It is refreshed when
+// it gets older than the TTL, when a token carries an unknown kid and whenever
+// the service announces a rotation.
+type jwksCache struct {
+	mu      sync.RWMutex
+	keys    map[string]verificationKey
+	fetched time.Time
+}
+
+func (c *jwksCache) lookup(kid string) (verificationKey, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	key, ok := c.keys[kid]
+	return key, ok
+}
+
+func (c *jwksCache) age() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return time.Since(c.fetched)
+}
+
+func (c *jwksCache) store(data []byte) error {
+
+	var jwks jwk.JWKS
+
+	err := json.Unmarshal(data, &jwks)
+	if err != nil {
+		return fmt.Errorf("cannot parse key set: %w", err)
+	}
+
+	verificationKeys := map[string]verificationKey{}
+
+	for _, published := range jwks.Keys {
+		publicKey, err := published.PublicKey()
+		if err != nil {
+			return fmt.Errorf("cannot parse key %s: %w", published.Kid, err)
+		}
+
+		method := jwt.GetSigningMethod(published.Alg)
+		if method == nil {
+			return fmt.Errorf("key %s uses an unsupported algorithm %s", published.Kid, published.Alg)
+		}
+
+		verificationKeys[published.Kid] = verificationKey{
+			method: method,
+			key:    publicKey,
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.keys = verificationKeys
+	c.fetched = time.Now()
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package authclient
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// revocationList remembers the uuids pushed on the revocation stream for as
+// long as a token carrying them could still be unexpired.
+type revocationList struct {
+	mu        sync.Mutex
+	retention time.Duration
+	revoked   map[string]time.Time
+}
+
+func newRevocationList(retention time.Duration) *revocationList {
+	return &revocationList{
+		retention: retention,
+		revoked:   map[string]time.Time{},
+	}
+}
+
+func (l *revocationList) add(data []byte) error {
+
+	var event revocationEvent
+
+	err := json.Unmarshal(data, &event)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	for uuid, forgetAt := range l.revoked {
+		if now.After(forgetAt) {
+			delete(l.revoked, uuid)
+		}
+	}
+
+	for _, uuid := range event.Uuids {
+		l.revoked[uuid] = now.Add(l.retention)
+	}
+
+	return nil
+}
+
+func (l *revocationList) contains(uuid string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, ok := l.revoked[uuid]
+	return ok
+}
@@ -0,0 +1,81 @@
+// Package claims describes the JWT claims of the tokens issued by the user
+// service. It is shared by the service and its clients.
+package claims
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"strconv"
+)
+
+// Version is bumped whenever the claim layout changes, tokens of any other
+// version are refused.
+const Version = 1
+
+var ErrInvalid = errors.New("invalid claims")
+
+type Access struct {
+	jwt.StandardClaims
+	Version   int    `json:"ver"`
+	SessionID string `json:"sid"`
+	ClientID  string `json:"client_id,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	AuthTime  int64  `json:"auth_time"`
+}
+
+type Refresh struct {
+	jwt.StandardClaims
+	Version  int    `json:"ver"`
+	FamilyID string `json:"fid"`
+	ClientID string `json:"client_id,omitempty"`
+	AuthTime int64  `json:"auth_time"`
+}
+
+func (c *Access) Valid() error {
+	if c.Version != Version {
+		return fmt.Errorf("unsupported claims version %d", c.Version)
+	}
+	if c.Id == "" || c.SessionID == "" {
+		return errors.New("jti and sid claims are required")
+	}
+	return c.StandardClaims.Valid()
+}
+
+func (c *Refresh) Valid() error {
+	if c.Version != Version {
+		return fmt.Errorf("unsupported claims version %d", c.Version)
+	}
+	if c.Id == "" || c.FamilyID == "" {
+		return errors.New("jti and fid claims are required")
+	}
+	return c.StandardClaims.Valid()
+}
+
+// VerifyFor checks the claims that jwt-go leaves to the caller: the issuer and
+// that the token is meant for one of the given audiences.
+func VerifyFor(claims *jwt.StandardClaims, issuer string, audiences []string) error {
+
+	if !claims.VerifyIssuer(issuer, true) {
+		return fmt.Errorf("%w: unexpected issuer %q", ErrInvalid, claims.Issuer)
+	}
+
+	for _, audience := range audiences {
+		if claims.VerifyAudience(audience, true) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: unexpected audience %q", ErrInvalid, claims.Audience)
+}
+
+// UserID is the subject, tokens are always issued to a user
+func UserID(claims *jwt.StandardClaims) (int, error) {
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return 0, fmt.Errorf("%w: sub is not a user id", ErrInvalid)
+	}
+
+	return userID, nil
+}
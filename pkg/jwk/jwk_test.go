@@ -0,0 +1,213 @@
+package jwk
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"github.com/dgrijalva/jwt-go"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// RFC 7638 section 3.1
+const rfc7638Modulus = "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw"
+
+// RFC 8037 appendix A
+const (
+	rfc8037PrivateKey = "nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A"
+	rfc8037PublicKey  = "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"
+)
+
+func TestThumbprint(t *testing.T) {
+
+	tests := []struct {
+		name string
+		jwk  JWK
+		want string
+	}{
+		{
+			name: "RFC 7638 RSA",
+			jwk:  JWK{Kty: "RSA", N: rfc7638Modulus, E: "AQAB", Alg: "RS256", Kid: "2011-04-29"},
+			want: "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs",
+		},
+		{
+			name: "RFC 8037 Ed25519",
+			jwk:  JWK{Kty: "OKP", Crv: "Ed25519", X: rfc8037PublicKey},
+			want: "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.jwk.Thumbprint()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Thumbprint() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThumbprintIgnoresOptionalMembers(t *testing.T) {
+
+	bare := JWK{Kty: "RSA", N: rfc7638Modulus, E: "AQAB"}
+	full := JWK{Kty: "RSA", N: rfc7638Modulus, E: "AQAB", Use: "sig", Alg: "RS256", Kid: "other"}
+
+	bareThumbprint, _ := bare.Thumbprint()
+	fullThumbprint, _ := full.Thumbprint()
+
+	if bareThumbprint != fullThumbprint {
+		t.Errorf("thumbprints differ: %s and %s", bareThumbprint, fullThumbprint)
+	}
+
+	_, err := (&JWK{Kty: "oct"}).Thumbprint()
+	if err == nil {
+		t.Error("Thumbprint() of an unsupported key type succeeded")
+	}
+}
+
+func TestNewRoundTrip(t *testing.T) {
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		alg       string
+		publicKey interface{}
+		kty       string
+	}{
+		{"RSA", "RS256", &rsaKey.PublicKey, "RSA"},
+		{"P-256", "ES256", &ecKey.PublicKey, "EC"},
+		{"Ed25519", "EdDSA", edPublic, "OKP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jwk, err := New("kid", tt.alg, tt.publicKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if jwk.Kty != tt.kty || jwk.Alg != tt.alg || jwk.Use != "sig" || jwk.Kid != "kid" {
+				t.Errorf("New() = %+v", jwk)
+			}
+
+			// what a client parses from the published key set
+			data, err := json.Marshal(JWKS{Keys: []JWK{*jwk}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var jwks JWKS
+			err = json.Unmarshal(data, &jwks)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			publicKey, err := jwks.Keys[0].PublicKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(publicKey, tt.publicKey) {
+				t.Errorf("PublicKey() = %v, want %v", publicKey, tt.publicKey)
+			}
+		})
+	}
+}
+
+func TestEncodingOmitsForeignMembers(t *testing.T) {
+
+	edPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwk, err := New("kid", "EdDSA", edPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(jwk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, member := range []string{`"n"`, `"e"`, `"y"`} {
+		if strings.Contains(string(data), member) {
+			t.Errorf("%s has member %s", data, member)
+		}
+	}
+}
+
+func TestPublicKeyRejects(t *testing.T) {
+
+	tests := []struct {
+		name string
+		jwk  JWK
+	}{
+		{"unknown key type", JWK{Kty: "oct"}},
+		{"unsupported curve", JWK{Kty: "EC", Crv: "P-384", X: "AA", Y: "AA"}},
+		{"short Ed25519 key", JWK{Kty: "OKP", Crv: "Ed25519", X: "AAAA"}},
+		{"X25519 key", JWK{Kty: "OKP", Crv: "X25519", X: rfc8037PublicKey}},
+		{"bad encoding", JWK{Kty: "RSA", N: "not base64!", E: "AQAB"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.jwk.PublicKey()
+			if err == nil {
+				t.Error("PublicKey() succeeded")
+			}
+		})
+	}
+}
+
+// RFC 8037 appendix A.4
+func TestEdDSASignature(t *testing.T) {
+
+	seed, err := jwt.DecodeSegment(rfc8037PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey := ed25519.NewKeyFromSeed(seed)
+
+	signingString := "eyJhbGciOiJFZERTQSJ9.RXhhbXBsZSBvZiBFZDI1NTE5IHNpZ25pbmc"
+	want := "hgyY0il_MGCjP0JzlnLWG1PPOt7-09PGcvMg3AIbQR6dWbhijcNR4ki4iylGjg5BhVsPt9g7sVvpAr_MuM0KAg"
+
+	signature, err := SigningMethodEd25519.Sign(signingString, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signature != want {
+		t.Errorf("Sign() = %s, want %s", signature, want)
+	}
+
+	err = SigningMethodEd25519.Verify(signingString, want, privateKey.Public())
+	if err != nil {
+		t.Errorf("Verify() = %v", err)
+	}
+
+	err = SigningMethodEd25519.Verify(signingString+"x", want, privateKey.Public())
+	if err == nil {
+		t.Error("Verify() of a changed payload succeeded")
+	}
+
+	if jwt.GetSigningMethod("EdDSA") != SigningMethodEd25519 {
+		t.Error("EdDSA is not registered with jwt-go")
+	}
+}
@@ -0,0 +1,118 @@
+// Package response is the reply envelope every subject of the user service
+// answers with, together with the stable error codes clients branch on.
+package response
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// the error code and message are duplicated into these headers, so a client
+// can branch without parsing the body
+const (
+	HeaderErrorCode    = "Error-Code"
+	HeaderErrorMessage = "Error-Message"
+	// HeaderRetryAfter is set in seconds on errors that pass with time
+	HeaderRetryAfter = "Retry-After"
+)
+
+const (
+	CodeInternal            = "INTERNAL"
+	CodeBadRequest          = "BAD_REQUEST"
+	CodeValidationFailed    = "VALIDATION_FAILED"
+	CodePayloadTooLarge     = "PAYLOAD_TOO_LARGE"
+	CodeUserExists          = "USER_EXISTS"
+	CodeEmailExists         = "EMAIL_EXISTS"
+	CodeEmailNotVerified    = "EMAIL_NOT_VERIFIED"
+	CodeInvalidCredentials  = "INVALID_CREDENTIALS"
+	CodeAccountLocked       = "ACCOUNT_LOCKED"
+	CodeRateLimited         = "RATE_LIMITED"
+	CodeUnknownClient       = "UNKNOWN_CLIENT"
+	CodeTokenInvalid        = "TOKEN_INVALID"
+	CodeTokenExpired        = "TOKEN_EXPIRED"
+	CodeTokenRevoked        = "TOKEN_REVOKED"
+	CodeTokenReused         = "TOKEN_REUSED"
+	CodeSessionNotFound     = "SESSION_NOT_FOUND"
+	CodeProfileConflict     = "PROFILE_CONFLICT"
+	CodeResetTokenInvalid   = "RESET_TOKEN_INVALID"
+	CodeVerificationInvalid = "VERIFICATION_TOKEN_INVALID"
+	CodeMFACodeInvalid      = "MFA_CODE_INVALID"
+	CodeMFAChallengeInvalid = "MFA_CHALLENGE_INVALID"
+	CodeMFAAlreadyEnabled   = "MFA_ALREADY_ENABLED"
+	CodeMFANotEnabled       = "MFA_NOT_ENABLED"
+	CodeForbidden           = "FORBIDDEN"
+	CodeNotSupported        = "NOT_SUPPORTED"
+	CodeUnauthorized        = "UNAUTHORIZED"
+	CodeNotFound            = "NOT_FOUND"
+	CodeConflict            = "CONFLICT"
+)
+
+type Response struct {
+	Ok    bool            `json:"ok"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error *Error          `json:"error,omitempty"`
+}
+
+type Error struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// RetryDetails are the details of errors that pass with time
+type RetryDetails struct {
+	RetryAfter int `json:"retry_after"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func Success(data interface{}) ([]byte, error) {
+
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(Response{
+		Ok:   true,
+		Data: dataBytes,
+	})
+}
+
+func Failure(code, message string, details interface{}) ([]byte, error) {
+	return json.Marshal(Response{
+		Ok: false,
+		Error: &Error{
+			Code:    code,
+			Message: message,
+			Details: details,
+		},
+	})
+}
+
+// Decode unwraps a reply: data is filled on success, the *Error is returned
+// otherwise.
+func Decode(reply []byte, data interface{}) error {
+
+	var r Response
+
+	err := json.Unmarshal(reply, &r)
+	if err != nil {
+		return fmt.Errorf("cannot parse reply: %w", err)
+	}
+
+	if !r.Ok {
+		if r.Error == nil {
+			return &Error{Code: CodeInternal, Message: "malformed error reply"}
+		}
+		return r.Error
+	}
+
+	if data == nil || len(r.Data) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(r.Data, data)
+}
@@ -0,0 +1,13 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS deleted_at timestamptz,
+    ADD COLUMN IF NOT EXISTS purged_at timestamptz;
+
+-- a deleted account gives its address free for a new one
+DROP INDEX IF EXISTS users_email_lower_idx;
+CREATE UNIQUE INDEX users_email_lower_idx ON users (lower(email)) WHERE email <> '' AND deleted_at IS NULL;
+
+-- a deleted account frees its name too, and only a unique index keeps a
+-- concurrent sign-up and restore from both taking it
+CREATE UNIQUE INDEX users_name_active_idx ON users (name) WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS users_deleted_at_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL
@@ -0,0 +1,26 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at timestamptz;
+
+-- profile updates did not compare addresses case-insensitively. Accounts that
+-- share an address have to be sorted out by hand before the index is built,
+-- the migration stops and lists them.
+DO $$
+DECLARE
+    conflicts text;
+BEGIN
+    SELECT string_agg(format('%s (ids %s)', address, ids), ', ')
+    INTO conflicts
+    FROM (
+        SELECT lower(email) AS address, string_agg(id::text, ', ' ORDER BY id) AS ids
+        FROM users
+        WHERE email <> ''
+        GROUP BY lower(email)
+        HAVING count(*) > 1
+    ) duplicates;
+
+    IF conflicts IS NOT NULL THEN
+        RAISE EXCEPTION 'email addresses shared by several users: %', conflicts;
+    END IF;
+END
+$$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower_idx ON users (lower(email)) WHERE email <> ''
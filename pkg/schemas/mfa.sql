@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS user_mfa (
+    user_id bigint primary key references users (id) on delete cascade,
+    secret bytea not null,
+    enabled boolean not null default false,
+    last_used_step bigint not null default 0,
+    created timestamptz default current_timestamp,
+    confirmed timestamptz
+)
@@ -0,0 +1,5 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS display_name text not null default '',
+    ADD COLUMN IF NOT EXISTS email text not null default '',
+    ADD COLUMN IF NOT EXISTS locale text not null default '',
+    ADD COLUMN IF NOT EXISTS timezone text not null default ''
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    id bigserial primary key,
+    user_id bigint not null references user_mfa (user_id) on delete cascade,
+    code_hash text not null,
+    used timestamptz,
+    created timestamptz default current_timestamp
+);
+
+CREATE INDEX IF NOT EXISTS user_recovery_codes_user_id_idx ON user_recovery_codes (user_id)